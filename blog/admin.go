@@ -0,0 +1,81 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// Will return true if the path falls under one of the admin path prefixes
+func (blog *Blog) isAdminPath(path string) bool {
+	for _, prefix := range blog.configuration.AdminPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Will return true if the request contains the configured admin credentials
+func (blog *Blog) isAdmin(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok || blog.configuration.AdminPassword == "" {
+		return false
+	}
+
+	// Compare both values in constant time so neither can be guessed from the timing
+	validUser := subtle.ConstantTimeCompare([]byte(user), []byte(blog.configuration.AdminUser))
+	validPassword := subtle.ConstantTimeCompare([]byte(password), []byte(blog.configuration.AdminPassword))
+	return validUser&validPassword == 1
+}
+
+// Will return true if the request has the admin credentials, otherwise the unauthorized response is written
+func (blog *Blog) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if blog.isAdmin(r) {
+		return true
+	}
+	if _, _, ok := r.BasicAuth(); ok {
+		logger.Warn("Invalid admin credentials for %s from %s", r.URL.Path, blog.clientIP(r))
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+blog.configuration.Title+`"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	return false
+}
+
+// adminAuthHandler will enforce HTTP basic authentication on all the admin paths
+func (blog *Blog) adminAuthHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if blog.isAdminPath(r.URL.Path) && !blog.requireAdmin(w, r) {
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Handles the requests to manually reload the posts from the posts directory
+func reloadHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+
+	// Always require the admin credentials so the reload is protected whatever the admin paths are
+	if !blog.requireAdmin(w, r) {
+		return
+	}
+
+	// Only allow the reload to be triggered using a POST
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The load is protected by the mutex so this is safe to be called at any time
+	if err := blog.loadPosts(); err != nil {
+		logger.Error("Could not reload posts: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"posts": len(blog.snapshot().posts)})
+}
@@ -0,0 +1,99 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuthHandler(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.AdminUser, c.AdminPassword = "admin", "secret"
+	})
+	handler := blog.adminAuthHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name           string
+		user, password string
+		path           string
+		status         int
+	}{
+		{"correct credentials", "admin", "secret", "/admin/reload", http.StatusOK},
+		{"incorrect password", "admin", "wrong", "/admin/reload", http.StatusUnauthorized},
+		{"incorrect user", "root", "secret", "/admin/reload", http.StatusUnauthorized},
+		{"missing credentials", "", "", "/admin/reload", http.StatusUnauthorized},
+		{"public path", "", "", "/posts", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", test.path, nil)
+		if test.user != "" {
+			r.SetBasicAuth(test.user, test.password)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, w.Code)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", test.name)
+		}
+	}
+}
+
+func TestReloadHandlerRequiresAdmin(t *testing.T) {
+
+	// The reload must stay protected even when it is not within the admin paths
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.AdminUser, c.AdminPassword = "admin", "secret"
+		c.AdminPaths = []string{"/dashboard/"}
+	})
+	handler := blog.adminAuthHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reloadHandler(w, r, blog, "")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/admin/reload", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without credentials, got %d", http.StatusUnauthorized, w.Code)
+	}
+
+	r := httptest.NewRequest("POST", "/admin/reload", nil)
+	r.SetBasicAuth("admin", "secret")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d with credentials, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestReloadHandlerLoadsNewPosts(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	}, func(c *Configuration) {
+		c.AdminUser, c.AdminPassword = "admin", "secret"
+	})
+	writeFiles(t, blog.configuration.Postsdir, map[string]string{
+		"other.json": `{"Title": "Other Post", "Body": "<p>Other</p>"}`,
+	})
+	r := httptest.NewRequest("POST", "/admin/reload", nil)
+	r.SetBasicAuth("admin", "secret")
+	w := httptest.NewRecorder()
+	reloadHandler(w, r, blog, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if blog.snapshot().postMap["other-post"] == nil {
+		t.Errorf("expected the new post to be loaded")
+	}
+	var result map[string]int
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result["posts"] != 2 {
+		t.Errorf("expected the count of the loaded posts, got %v", result)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"crypto/subtle"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PostMeta is the lightweight representation of a post returned by the API (without the body)
+type PostMeta struct {
+	Title       string    `json:"title"`
+	Slug        string    `json:"slug"`
+	URL         string    `json:"url"`
+	WordCount   int       `json:"wordCount"`
+	ReadingTime int       `json:"readingTime"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+}
+
+// The path prefix for all the JSON API routes
+const apiPrefix = "/api/"
+
+// Will return true if the request contains one of the configured API keys
+func (blog *Blog) hasAPIKey(r *http.Request) bool {
+	key := []byte(r.Header.Get("X-API-Key"))
+	if len(key) == 0 {
+		return false
+	}
+
+	// Check every key so the timing does not reveal which (if any) matched
+	valid := 0
+	for _, k := range blog.configuration.APIKeys {
+		valid |= subtle.ConstantTimeCompare(key, []byte(k))
+	}
+	return valid == 1
+}
+
+// apiKeyHandler will require a valid API key on all the API routes when keys have been configured
+func (blog *Blog) apiKeyHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(blog.configuration.APIKeys) > 0 && strings.HasPrefix(r.URL.Path, apiPrefix) && !blog.hasAPIKey(r) {
+			writeJSONError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Will return true if the origin is allowed to access the API routes
+func (blog *Blog) isAllowedOrigin(origin string) bool {
+	for _, o := range blog.configuration.CORSOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// corsHandler will add the CORS headers to the API routes for the allowed origins
+// Preflight requests are answered directly as they do not carry the API key
+func (blog *Blog) corsHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !strings.HasPrefix(r.URL.Path, apiPrefix) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !blog.isAllowedOrigin(origin) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+
+		// Handle the preflight request
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(blog.configuration.CORSMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(blog.configuration.CORSHeaders, ", "))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Stats contains the statistics of the loaded posts returned by the API
+type Stats struct {
+	Posts  int        `json:"posts"`
+	Drafts int        `json:"drafts"`
+	Newest *time.Time `json:"newest,omitempty"`
+}
+
+// Handles the requests for the post statistics, these are all taken from the loaded posts
+func apiStatsHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+	data := blog.snapshot()
+	stats := Stats{Posts: len(data.posts), Drafts: len(data.drafts)}
+	if len(data.posts) > 0 {
+		stats.Newest = &data.posts[0].Created
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// Handles the requests for any unknown API route
+func apiNotFoundHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+	writeJSONError(w, http.StatusNotFound, "not found")
+}
+
+// Will write the error message to the response as JSON, e.g. {"error":"not found"}
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Handles all the requests for a specific post within the API, e.g. /api/posts/{slug}/meta
+func apiPostHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+
+	// Split the path into the post slug and the requested resource
+	rest := strings.TrimPrefix(r.URL.Path, apiPrefix+"posts/")
+	postName, resource := rest, ""
+	if i := strings.LastIndex(rest, "/"); i >= 0 {
+		postName, resource = rest[:i], rest[i+1:]
+	}
+
+	// The raw source and the changes to the post are only available to the admin
+	if (resource == "raw" || resource == "") && !blog.requireAdmin(w, r) {
+		return
+	}
+
+	// Locate the post (the admin can also change the drafts)
+	setSpanPost(r, postName)
+	data := blog.snapshot()
+	post := data.postMap[postName]
+	if post == nil && resource == "" {
+		post = data.drafts[postName]
+	}
+	if post == nil {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	// The post itself can only be updated or deleted, and the rest of the resources are read only
+	allowed, allow := r.Method == "GET", "GET"
+	if resource == "" {
+		allowed, allow = r.Method == "PUT" || r.Method == "DELETE", "PUT, DELETE"
+	}
+	if !allowed {
+		w.Header().Set("Allow", allow)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	switch resource {
+	case "":
+		if r.Method == "PUT" {
+			apiUpdatePostHandler(w, r, blog, post)
+		} else {
+			apiDeletePostHandler(w, r, blog, post)
+		}
+	case "meta":
+		apiPostMetaHandler(w, r, blog, post)
+	case "raw":
+		apiPostRawHandler(w, r, blog, post)
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// Handles the requests for the metadata of a post
+func apiPostMetaHandler(w http.ResponseWriter, r *http.Request, blog *Blog, post *Post) {
+
+	// The body is required to count the words
+	loaded, err := blog.loadBody(post)
+	if err != nil {
+		logger.Error("Cannot load the body for post %s: %s", post.SafeTitle(), err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, blog.postMeta(loaded))
+}
+
+// Will return the metadata of the post (the body must have been loaded)
+func (blog *Blog) postMeta(post *Post) PostMeta {
+	return PostMeta{Title: post.Title, Slug: post.SafeTitle(), URL: post.Permalink(blog.configuration.SiteURL),
+		WordCount: post.WordCount(), ReadingTime: post.ReadingTime(), Created: post.Created, Updated: post.Updated}
+}
+
+// Handles the requests for the original contents of the post file
+func apiPostRawHandler(w http.ResponseWriter, r *http.Request, blog *Blog, post *Post) {
+	f, err := os.Open(post.FileName)
+	if err != nil {
+		logger.Error("Cannot open post %s: %s", post.FileName, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, "cannot read post")
+		return
+	}
+	defer f.Close()
+
+	// Use the content type of the file extension
+	contentType := mime.TypeByExtension(filepath.Ext(post.FileName))
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := io.Copy(w, f); err != nil {
+		logger.Error("Cannot write post %s: %s", post.FileName, err.Error())
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyHandler(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.APIKeys = []string{"first", "second"}
+	})
+	handler := blog.apiKeyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name   string
+		key    string
+		path   string
+		status int
+	}{
+		{"valid key", "second", "/api/stats", http.StatusOK},
+		{"invalid key", "third", "/api/stats", http.StatusUnauthorized},
+		{"absent key", "", "/api/stats", http.StatusUnauthorized},
+		{"not an api route", "", "/posts", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.key != "" {
+			r.Header.Set("X-API-Key", test.key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, w.Code)
+		}
+		if w.Code == http.StatusUnauthorized && w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+			t.Errorf("%s: expected a JSON error, got %s", test.name, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestPostMeta(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>` + strings.Repeat("word ", 450) + `</p>",
+			"Created": "2013-06-01T00:00:00Z", "Updated": "2013-06-05T00:00:00Z"}`,
+	}, nil)
+	w := httptest.NewRecorder()
+	apiPostHandler(w, httptest.NewRequest("GET", "/api/posts/hello-world/meta", nil), blog, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &meta); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"title": "Hello World", "slug": "hello-world", "url": "/posts/hello-world",
+		"wordCount": 450.0, "readingTime": 3.0, "created": "2013-06-01T00:00:00Z", "updated": "2013-06-05T00:00:00Z"}
+	for key, value := range expected {
+		if meta[key] != value {
+			t.Errorf("expected %s to be %v, got %v", key, value, meta[key])
+		}
+	}
+
+	w = httptest.NewRecorder()
+	apiPostHandler(w, httptest.NewRequest("GET", "/api/posts/missing/meta", nil), blog, "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for an unknown post, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestPostRaw(t *testing.T) {
+	source := `{"Title": "Hello World", "Body": "<p>The body</p>"}`
+	blog := newTestBlog(t, map[string]string{"hello.json": source}, func(c *Configuration) {
+		c.AdminUser, c.AdminPassword = "admin", "secret"
+	})
+	for path, status := range map[string]int{"/api/posts/hello-world/raw": http.StatusOK, "/api/posts/missing/raw": http.StatusNotFound} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.SetBasicAuth("admin", "secret")
+		w := httptest.NewRecorder()
+		apiPostHandler(w, r, blog, "")
+		if w.Code != status {
+			t.Errorf("%s: expected status %d, got %d", path, status, w.Code)
+			continue
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		if w.Body.String() != source {
+			t.Errorf("expected the contents of the file, got %q", w.Body.String())
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("expected the content type of the file, got %s", contentType)
+		}
+	}
+}
+
+func TestCORSHandler(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.CORSOrigins = []string{"https://allowed.example.com"}
+	})
+	handler := blog.corsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("handled"))
+	}))
+
+	// The preflight request is answered without calling the handler
+	r := httptest.NewRequest("OPTIONS", "/api/stats", nil)
+	r.Header.Set("Origin", "https://allowed.example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("expected status %d for the preflight, got %d %q", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	for header, expected := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://allowed.example.com",
+		"Access-Control-Allow-Methods": "GET, OPTIONS",
+		"Access-Control-Allow-Headers": "Content-Type, X-API-Key",
+	} {
+		if value := w.Header().Get(header); value != expected {
+			t.Errorf("expected the %s header %q, got %q", header, expected, value)
+		}
+	}
+
+	// A simple request from an allowed origin
+	r = httptest.NewRequest("GET", "/api/stats", nil)
+	r.Header.Set("Origin", "https://allowed.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Body.String() != "handled" || w.Header().Get("Access-Control-Allow-Origin") != "https://allowed.example.com" {
+		t.Errorf("expected the allowed origin to be returned, got %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	// But nothing is allowed for any other origin
+	r = httptest.NewRequest("GET", "/api/stats", nil)
+	r.Header.Set("Origin", "https://other.example.com")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected the origin not to be allowed, got %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w.Header().Get("Vary") != "Origin" {
+		t.Errorf("expected the response to vary by origin")
+	}
+}
+
+func TestAPIStats(t *testing.T) {
+	posts := numberedPosts(3)
+	posts["draft.json"] = `{"Title": "Draft", "Draft": true, "Created": "2013-07-01T00:00:00Z"}`
+	blog := newTestBlog(t, posts, nil)
+	w := httptest.NewRecorder()
+	apiStatsHandler(w, httptest.NewRequest("GET", "/api/stats", nil), blog, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	expected := `{"posts":3,"drafts":1,"newest":"2013-06-03T00:00:00Z"}`
+	if stats := strings.TrimSpace(w.Body.String()); stats != expected {
+		t.Errorf("expected the stats %s, got %s", expected, stats)
+	}
+
+	// The newest is omitted when there are no posts
+	blog = newTestBlog(t, nil, nil)
+	w = httptest.NewRecorder()
+	apiStatsHandler(w, httptest.NewRequest("GET", "/api/stats", nil), blog, "")
+	if stats := strings.TrimSpace(w.Body.String()); stats != `{"posts":0,"drafts":0}` {
+		t.Errorf("expected the empty stats, got %s", stats)
+	}
+}
+
+func TestAPINotFound(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(1), nil)
+	tests := []struct {
+		name    string
+		handler func(http.ResponseWriter, *http.Request, *Blog, string)
+		path    string
+	}{
+		{"unknown slug", apiPostHandler, "/api/posts/unknown/meta"},
+		{"unknown resource", apiPostHandler, "/api/posts/post-1/unknown"},
+		{"unknown route", apiNotFoundHandler, "/api/unknown"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		test.handler(w, httptest.NewRequest("GET", test.path, nil), blog, "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", test.name, http.StatusNotFound, w.Code)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+			t.Errorf("%s: expected a JSON response, got %s", test.name, contentType)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != `{"error":"not found"}` {
+			t.Errorf("%s: expected the JSON error, got %s", test.name, body)
+		}
+	}
+}
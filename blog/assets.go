@@ -0,0 +1,129 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// assetVersion is the content hash of an asset along with the state of the file when it was hashed
+type assetVersion struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// assetVersions caches the content hash of each asset so that the files are only hashed when they change
+type assetVersions struct {
+	sync.Mutex
+	versions map[string]assetVersion
+}
+
+// Will return the hash of the contents of the asset file, re-hashing the file only if it has changed
+func (a *assetVersions) hash(file string) (string, error) {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	a.Lock()
+	defer a.Unlock()
+	if v, ok := a.versions[file]; ok && v.modTime.Equal(stat.ModTime()) && v.size == stat.Size() {
+		return v.hash, nil
+	}
+
+	// Hash the contents of the file
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))[:12]
+	if a.versions == nil {
+		a.versions = make(map[string]assetVersion)
+	}
+	a.versions[file] = assetVersion{modTime: stat.ModTime(), size: stat.Size(), hash: hash}
+	return hash, nil
+}
+
+// Will return the path of the asset with the content hash appended, e.g. /assets/css/style.css?v=abc123
+// This allows the versioned assets to be cached indefinitely by the browser
+func (blog *Blog) assetPath(name string) string {
+	p := path.Join(blog.configuration.AssetPrefix, name)
+	hash, err := blog.assetVersions.hash(filepath.Join(blog.configuration.Assetsdir, filepath.FromSlash(path.Clean("/"+name))))
+	if err != nil {
+		logger.Warn("Cannot version asset %s: %s", name, err.Error())
+		return p
+	}
+	return p + "?v=" + url.QueryEscape(hash)
+}
+
+// Will set the far future cache headers for the requests of versioned assets
+func cacheVersionedHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("v") != "" {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// The name of the manifest within the asset prefix, e.g. /assets/manifest.json
+const assetManifest = "manifest.json"
+
+// Will build the manifest mapping each asset name to its versioned path, e.g. {"css/style.css": "/assets/css/style.css?v=abc123"}
+func (blog *Blog) assetManifest() ([]byte, error) {
+	manifest := make(map[string]string)
+
+	// A blog without any assets simply has an empty manifest
+	if _, err := os.Stat(blog.configuration.Assetsdir); os.IsNotExist(err) {
+		return json.Marshal(manifest)
+	}
+	err := filepath.Walk(blog.configuration.Assetsdir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(blog.configuration.Assetsdir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == assetManifest {
+			return nil
+		}
+		manifest[name] = blog.assetPath(name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(manifest)
+}
+
+// Will serve the asset manifest that was generated at startup
+func manifestHandler(manifest []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(manifest)
+	})
+}
@@ -0,0 +1,125 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAssetRangeRequest(t *testing.T) {
+	blog := newTestBlog(t, nil, nil)
+	writeFiles(t, blog.configuration.Assetsdir, map[string]string{"video.txt": "0123456789"})
+	handler := blog.wrapHandler(blog.assetHandler())
+
+	r := httptest.NewRequest("GET", "/assets/video.txt?v=abc", nil)
+	r.Header.Set("Range", "bytes=2-5")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("expected status %d, got %d", http.StatusPartialContent, w.Code)
+	}
+	if w.Body.String() != "2345" {
+		t.Errorf("expected the requested bytes, got %q", w.Body.String())
+	}
+	if w.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("expected the content range, got %q", w.Header().Get("Content-Range"))
+	}
+	if w.Header().Get("Cache-Control") == "" {
+		t.Errorf("expected the versioned asset to be cached")
+	}
+
+	// An unsatisfiable range is not replaced by the not found page
+	r = httptest.NewRequest("GET", "/assets/video.txt", nil)
+	r.Header.Set("Range", "bytes=20-30")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected status %d, got %d", http.StatusRequestedRangeNotSatisfiable, w.Code)
+	}
+}
+
+func TestMissingAssetThemedNotFound(t *testing.T) {
+	blog := newTestBlog(t, nil, nil)
+	w := httptest.NewRecorder()
+	blog.assetHandler().ServeHTTP(w, httptest.NewRequest("GET", "/assets/missing.css", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	expected := "<title>" + blog.message("notfound.title") + "</title>" + blog.message("notfound.message")
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("expected the themed not found page, got %q", w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("expected the content type of the page, got %s", contentType)
+	}
+}
+
+func TestAssetPath(t *testing.T) {
+	blog := newTestBlog(t, nil, nil)
+	writeFiles(t, blog.configuration.Assetsdir, map[string]string{"style.css": "body {}"})
+	first := blog.assetPath("style.css")
+	if !strings.HasPrefix(first, "/assets/style.css?v=") || first == "/assets/style.css?v=" {
+		t.Fatalf("expected the versioned path, got %s", first)
+	}
+	if again := blog.assetPath("style.css"); again != first {
+		t.Errorf("expected the same version for an unchanged asset, got %s and %s", first, again)
+	}
+
+	// Changing the asset changes the version
+	writeFiles(t, blog.configuration.Assetsdir, map[string]string{"style.css": "body { color: red }"})
+	if changed := blog.assetPath("style.css"); changed == first || !strings.HasPrefix(changed, "/assets/style.css?v=") {
+		t.Errorf("expected a new version after the change, got %s and %s", first, changed)
+	}
+
+	// A missing asset is not versioned
+	if missing := blog.assetPath("missing.css"); missing != "/assets/missing.css" {
+		t.Errorf("expected the unversioned path, got %s", missing)
+	}
+}
+
+func TestAssetPrefix(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.AssetPrefix = "static"
+	})
+	writeFiles(t, blog.configuration.Assetsdir, map[string]string{"style.css": "body {}"})
+	if blog.configuration.AssetPrefix != "/static/" {
+		t.Errorf("expected the prefix to be normalised, got %s", blog.configuration.AssetPrefix)
+	}
+	w := httptest.NewRecorder()
+	blog.assetHandler().ServeHTTP(w, httptest.NewRequest("GET", "/static/style.css", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "body {}" {
+		t.Errorf("expected the asset, got %d %q", w.Code, w.Body.String())
+	}
+	if p := blog.assetPath("style.css"); !strings.HasPrefix(p, "/static/style.css?v=") {
+		t.Errorf("expected the asset path within the prefix, got %s", p)
+	}
+}
+
+func TestAssetManifest(t *testing.T) {
+	blog := newTestBlog(t, nil, nil)
+	writeFiles(t, blog.configuration.Assetsdir, map[string]string{"style.css": "body {}", ".hidden": "", "manifest.json": "{}"})
+	b, err := blog.assetManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest map[string]string
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest) != 1 || manifest["style.css"] != blog.assetPath("style.css") || !strings.Contains(manifest["style.css"], "?v=") {
+		t.Errorf("expected only the versioned path of the asset, got %v", manifest)
+	}
+
+	// The manifest is served as JSON
+	w := httptest.NewRecorder()
+	manifestHandler(b).ServeHTTP(w, httptest.NewRequest("GET", "/assets/manifest.json", nil))
+	if w.Body.String() != string(b) || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("expected the manifest, got %s %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The path segment beneath a post that its attachments are served from
+const attachmentsSegment = "/files/"
+
+// Attachment is a downloadable file that belongs to a post
+type Attachment struct {
+	Name string // The file name the attachment is downloaded as
+	Path string // The location of the file relative to the post file
+	Size int64  // The size of the file in bytes (this is set when the post is loaded)
+}
+
+// AttachmentURL will return the path the attachment is downloaded from
+func (blog *Post) AttachmentURL(attachment Attachment) string {
+	return blog.URL() + attachmentsSegment + url.PathEscape(attachment.Name)
+}
+
+// Will return the location of the attachment on disk
+// The path must stay within the directory of the post file so no other files can be downloaded
+func (blog *Post) attachmentPath(attachment Attachment) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(attachment.Path))
+	if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" || rel == "." || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidAttachment, attachment.Path)
+	}
+	return filepath.Join(filepath.Dir(blog.FileName), rel), nil
+}
+
+// Will set the size of each of the attachments from the files on disk
+// The attachments outside of the directory of the post are removed
+func (blog *Post) statAttachments() {
+	attachments := blog.Attachments[:0]
+	for _, attachment := range blog.Attachments {
+		file, err := blog.attachmentPath(attachment)
+		if err != nil {
+			logger.Warn("Ignoring attachment %s for post %s: %s", attachment.Name, blog.FileName, err.Error())
+			continue
+		}
+		if stat, err := os.Stat(file); err != nil {
+			logger.Warn("Cannot locate attachment %s for post %s", attachment.Path, blog.FileName)
+		} else {
+			attachment.Size = stat.Size()
+		}
+		attachments = append(attachments, attachment)
+	}
+	blog.Attachments = attachments
+}
+
+// Handles all the requests to download an attachment of a post
+func attachmentHandler(w http.ResponseWriter, r *http.Request, blog *Blog, post *Post, name string) {
+
+	// Only the files listed against the post can be downloaded
+	for _, attachment := range post.Attachments {
+		if attachment.Name != name {
+			continue
+		}
+		file, err := post.attachmentPath(attachment)
+		if err != nil {
+			logger.Error("Refusing to serve attachment %s for post %s: %s", name, post.FileName, err.Error())
+			break
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			break
+		}
+		defer f.Close()
+		stat, err := f.Stat()
+		if err != nil || stat.IsDir() {
+			break
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		http.ServeContent(w, r, name, stat.ModTime(), f)
+		return
+	}
+
+	// Redirect to the not found page
+	http.Redirect(w, r, "/notfound", http.StatusFound)
+}
@@ -0,0 +1,77 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttachmentDownload(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Attachments": [{"Name": "report.txt", "Path": "files/report.txt"}]}`,
+	}, func(c *Configuration) {
+		if err := os.Mkdir(filepath.Join(c.Postsdir, "files"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, filepath.Join(c.Postsdir, "files"), map[string]string{"report.txt": "The report"})
+	})
+	post := blog.snapshot().postMap["hello-world"]
+	if len(post.Attachments) != 1 || post.Attachments[0].Size != int64(len("The report")) {
+		t.Fatalf("expected the size of the attachment to be set, got %+v", post.Attachments)
+	}
+
+	w := httptest.NewRecorder()
+	viewPostHandler(w, httptest.NewRequest("GET", post.AttachmentURL(post.Attachments[0]), nil), blog, "post.html")
+	if w.Code != http.StatusOK || w.Body.String() != "The report" {
+		t.Fatalf("expected the attachment to be downloaded, got %d %q", w.Code, w.Body.String())
+	}
+	if disposition := w.Header().Get("Content-Disposition"); disposition != `attachment; filename=report.txt` {
+		t.Errorf("expected the attachment file name, got %s", disposition)
+	}
+}
+
+func TestAttachmentOutsidePostDirectory(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	writeFiles(t, filepath.Dir(secret), map[string]string{"secret.txt": "The secret"})
+	var relative string
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		var err error
+		if relative, err = filepath.Rel(c.Postsdir, secret); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, c.Postsdir, map[string]string{
+			"hello.json": fmt.Sprintf(`{"Title": "Hello World", "Attachments": [{"Name": "relative.txt", "Path": %q},
+				{"Name": "absolute.txt", "Path": %q}]}`, filepath.ToSlash(relative), filepath.ToSlash(secret)),
+		})
+	})
+
+	// The attachments are removed when the post is loaded
+	post := blog.snapshot().postMap["hello-world"]
+	if len(post.Attachments) != 0 {
+		t.Errorf("expected the attachments to be removed, got %+v", post.Attachments)
+	}
+	for _, name := range []string{"relative.txt", "absolute.txt"} {
+		w := httptest.NewRecorder()
+		viewPostHandler(w, httptest.NewRequest("GET", "/posts/hello-world/files/"+name, nil), blog, "post.html")
+		if strings.Contains(w.Body.String(), "The secret") {
+			t.Errorf("%s: expected the file outside of the posts directory not to be served", name)
+		}
+	}
+
+	// Nor are they served if they are on a post that was never checked
+	post = &Post{FileName: filepath.Join(blog.configuration.Postsdir, "hello.json"),
+		Attachments: []Attachment{{Name: "relative.txt", Path: relative}}}
+	w := httptest.NewRecorder()
+	attachmentHandler(w, httptest.NewRequest("GET", "/posts/hello-world/files/relative.txt", nil), blog, post, "relative.txt")
+	if strings.Contains(w.Body.String(), "The secret") {
+		t.Errorf("expected the file outside of the posts directory not to be served")
+	}
+}
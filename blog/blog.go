@@ -7,10 +7,16 @@ package blog
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
-	"io/ioutil"
+	"io/fs"
+	"net"
 	"net/url"
 	"os"
 	"path"
@@ -21,14 +27,60 @@ import (
 	"time"
 
 	"github.com/landonia/golog"
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/html"
 
 	"gopkg.in/fsnotify.v1"
 )
 
+// blogLogger writes the formatted messages of the blog, it is satisfied by the golog logger
+type blogLogger interface {
+	Debug(format string, args ...interface{})
+	Info(format string, args ...interface{})
+	Warn(format string, args ...interface{})
+	Error(format string, args ...interface{})
+	Fatal(format string, args ...interface{})
+}
+
 var (
-	logger = golog.New("simplegoblog.Blog")
+	logger blogLogger = golog.New("simplegoblog.Blog")
+
+	// Version and Commit identify the build of the blog, they can be set using the linker
+	// e.g. -ldflags "-X github.com/landonia/simplegoblog/blog.Commit=abc123"
+	Version = "dev"
+	Commit  = ""
 )
 
+// The default text of the built in messages, these can be replaced using Configuration.Messages
+var defaultMessages = map[string]string{
+	"notfound.title":      "Page Not Found",
+	"notfound.message":    "Sorry, the page you were looking for could not be found. Perhaps one of these posts will help.",
+	"unavailable.title":   "Service Unavailable",
+	"readmore":            "Read more",
+	"subscribe.title":     "Subscribe",
+	"subscribe.success":   "Thank you for subscribing.",
+	"subscribe.invalid":   "Please enter a valid email address.",
+	"subscribe.duplicate": "This email address has already subscribed.",
+	"subscribe.error":     "Sorry, your subscription could not be saved. Please try again later.",
+	"ratelimited.title":   "Too Many Requests",
+	"ratelimited.message": "You have made too many requests, please try again later.",
+}
+
+// The styles of the post permalinks
+const (
+	PermalinkSlug     = "slug"      // e.g. /posts/my-post
+	PermalinkDateSlug = "date-slug" // e.g. /posts/2013/06/my-post
+)
+
+// The layout of the date within the date based permalinks
+const permalinkDateLayout = "2006/01"
+
+// The time after creation before a change to the post is treated as an update
+const updatedThreshold = time.Hour
+
+// The amount a post date can be in the future (e.g. due to clock differences) before it is reported
+const futureDateSkew = 5 * time.Minute
+
 // The mutex for reading the posts in
 var mutex = &sync.Mutex{}
 
@@ -53,13 +105,66 @@ type ThrottleLimit struct {
 
 // Configuration contains information such as file directories etc
 type Configuration struct {
-	DevelopmentMode     bool
-	Postsdir            string
-	Templatesdir        string
-	Assetsdir           string
-	Title               string
-	NoOfRecentPosts     int
-	RequestHandlerLimit ThrottleLimit
+	DevelopmentMode       bool
+	Postsdir              string
+	PostsDirs             []string // Any additional directories that posts are loaded from
+	Templatesdir          string
+	Assetsdir             string
+	Title                 string
+	Description           string // The default meta description of the site
+	NoOfRecentPosts       int
+	RequestHandlerLimit   ThrottleLimit
+	RequestTimeout        time.Duration          // The maximum time taken to render a page before a 503 is returned (disabled if zero)
+	Tracing               bool                   // Wraps each request and reload within an OpenTelemetry span
+	MoreMarker            string                 // The marker within a post body where the listing excerpt ends
+	SiteURL               string                 // The absolute base URL of the site, e.g. http://www.example.com
+	DefaultImage          string                 // The Open Graph image used for pages (or posts) without an image
+	AdminUser             string                 // The user required to access the admin paths
+	AdminPassword         string                 // The password required to access the admin paths (admin is disabled if empty)
+	AdminPaths            []string               // The path prefixes protected by the admin credentials
+	APIKeys               []string               // The keys accepted in the X-API-Key header for the API routes (open if empty)
+	TransliterateSlugs    bool                   // Folds the post slugs into ASCII, e.g. "Café Göteborg" becomes "cafe-goteborg"
+	LazyBodies            bool                   // Only loads the post metadata up front and reads each body when first viewed
+	DisplayTimezone       string                 // The IANA timezone the dates are displayed in, e.g. Europe/London
+	PostsPath             string                 // The base path segment of the post routes, defaults to "posts"
+	CORSOrigins           []string               // The origins allowed to call the API routes ("*" allows any)
+	CORSMethods           []string               // The methods allowed for cross origin API requests
+	CORSHeaders           []string               // The headers allowed for cross origin API requests
+	RedirectNakedSlugs    bool                   // Redirects a top level path matching a post slug, e.g. /my-post, to the post
+	CopyrightOwner        string                 // The name displayed in the footer copyright
+	CopyrightYear         int                    // The year displayed in the footer copyright, defaults to the current year
+	PostExtensions        []string               // The extensions of the files that are loaded as posts, defaults to .json
+	TLSConfig             *tls.Config            // The TLS configuration used by StartTLS, defaults to TLS 1.2+ with modern ciphers
+	PreviewToken          string                 // The token required to preview a draft using /preview/{slug}?token= (disabled if empty)
+	OnReload              func(posts Posts)      // Called synchronously within the reloading goroutine after each successful load
+	PostsPerPage          int                    // The number of posts on each page of the post listing (all posts are listed if zero)
+	HomeRedirectToLatest  bool                   // Redirects the home page to the newest post (when there are posts)
+	ReadMoreText          string                 // The text of the link from a listed post to the full post, defaults to "Read more"
+	Messages              map[string]string      // The translated UI text by key, available within the templates using {{t "key"}}
+	SiteName              string                 // The Open Graph site name, defaults to the Title
+	Locale                string                 // The Open Graph locale, defaults to en_US
+	PermalinkStyle        string                 // Either PermalinkSlug (the default) or PermalinkDateSlug, e.g. /posts/2013/06/my-post
+	MaxConcurrentRequests int                    // The maximum number of requests handled at once before a 503 is returned (unlimited if zero)
+	AssetPrefix           string                 // The URL path prefix the assets are served from, defaults to /assets/
+	PollInterval          time.Duration          // Polls the posts directories for changes at this interval, for when file system events are unreliable
+	HSTSMaxAge            int                    // The max-age in seconds of the Strict-Transport-Security header sent over HTTPS (disabled if zero)
+	HSTSIncludeSubdomains bool                   // Adds includeSubDomains to the Strict-Transport-Security header
+	HSTSPreload           bool                   // Adds preload to the Strict-Transport-Security header
+	Subscribers           SubscriberStore        // Receives the email addresses submitted to /subscribe, defaults to a MemorySubscriberStore
+	SubscribeLimit        ThrottleLimit          // The throttle limit of the subscribe route, defaults to 3 per minute
+	GlobalData            map[string]interface{} // Site wide values available in every template as .Site, e.g. {{.Site.twitter}}
+	MinifyHTML            bool                   // Minifies the rendered HTML (outside of development mode)
+	MaxPostFileSize       int64                  // The maximum size in bytes of a post file, larger files are skipped (unlimited if zero)
+	Pages                 map[string]string      // Additional static pages as path -> content file (same format as a post), rendered using page.html
+	TrustedProxies        []string               // The IPs or CIDR ranges of the proxies whose X-Forwarded-For/X-Real-IP headers are trusted
+	HumansTxt             string                 // The file served as /humans.txt, a default crediting the CopyrightOwner is generated if empty
+	HomeExcerptLength     int                    // The maximum number of characters of each post excerpt on the home page (not truncated if zero)
+	Views                 ViewCounter            // Records the number of views of each post, defaults to a MemoryViewCounter
+	CanonicalHost         string                 // The host that requests for any other host are redirected to, e.g. example.com (disabled if empty)
+	SlugSeparator         string                 // The separator that replaces the spaces of the title within the post slugs, defaults to "-"
+	NoSlugSeparator       bool                   // Joins the words of the post slugs without a separator, as an empty SlugSeparator defaults to "-"
+	ClampFutureDates      bool                   // Sets a Created or Updated date that is in the future to the time the post was loaded
+	ArchiveAfter          time.Duration          // The age after which the posts are flagged as archived for the themes, e.g. 2 years (never if zero)
 }
 
 // Templates that are to be handled by this applicaton
@@ -69,20 +174,69 @@ type Templates struct {
 
 // Blog is the root data store for this blog
 type Blog struct {
-	configuration *Configuration
-	posts         Posts
-	postMap       map[string]*Post
-	templates     *template.Template
+	configuration  *Configuration
+	data           *postData
+	dataMutex      sync.RWMutex
+	files          map[string]*cachedPost
+	parsed         int // The number of post files that have been parsed by all of the loads
+	assetVersions  assetVersions
+	scheduled      *time.Timer
+	minifier       *minify.M
+	reloading      *reload
+	pending        *reload // The load that follows the load in progress
+	reloadMutex    sync.Mutex
+	templates      *template.Template
+	layouts        map[string]*template.Template // The alternate layouts of the posts by their path within the theme
+	location       *time.Location
+	trustedProxies []*net.IPNet
+	bodies         sync.Map // The lazily loaded bodies by bodyKey
+	routes         []string
+	watchErr       error // The error watching the posts directories, returned when the blog is started
+}
+
+// postData is a snapshot of the loaded posts that is replaced as a whole on each reload
+type postData struct {
+	posts   Posts
+	postMap map[string]*Post
+	drafts  map[string]*Post
+	updated Posts   // The posts ordered by when they were last updated
+	errors  []error // The errors of the post files that were skipped
+}
+
+// reload is a load of the posts that is in progress (or waiting to follow the load in progress)
+type reload struct {
+	done    chan struct{}
+	err     error
+	waiting int // The number of calls that are waiting for the result of the load
+}
+
+// cachedPost is a previously read post along with the state of its file when it was read
+type cachedPost struct {
+	modTime time.Time
+	size    int64
+	post    Post
 }
 
 // Post is a representation of a single post within the blog
 type Post struct {
-	FileName string
-	Created  time.Time
-	Updated  time.Time
-	Title    string
-	Summary  string
-	Body     string
+	FileName    string
+	Created     time.Time
+	Updated     time.Time
+	Title       string
+	Summary     string
+	Body        string
+	CoverImage  string
+	Attachments []Attachment
+	Draft       bool      // Drafts are hidden (unless in development mode) and can be viewed using the preview route
+	PublishAt   time.Time // The post is hidden until this time (if set)
+	ExpireAt    time.Time // The post is hidden from this time (if set)
+	NoIndex     bool      // The post should not be indexed by search engines, e.g. a thank you page
+	Template    string    // The layout the post is rendered with instead of post.html, e.g. landing.html for layouts/landing.html
+	slug        string
+	path        string
+	listing     string
+	modTime     time.Time
+	defaulted   bool // The updated time was not set by the post so it is the file modification time
 }
 
 // Posts type for an array of post pointers
@@ -95,7 +249,13 @@ func (posts Posts) Less(i, j int) bool { return posts[i].Created.After(posts[j].
 // SafeTitle will make the title safe for use within the URL
 func (blog *Post) SafeTitle() string {
 
-	// Replace all spaces of the title with '-'
+	// Use the slug generated when the post was loaded
+	if blog.slug != "" {
+		return blog.slug
+	}
+
+	// The posts that were not loaded by a blog (e.g. created by the caller) do not know
+	// the configured separator, so all spaces of the title are replaced with the default '-'
 	return strings.ToLower(strings.Replace(blog.Title, " ", "-", -1))
 }
 
@@ -106,6 +266,77 @@ func (blog *Post) SafeURL() string {
 	return url.QueryEscape(blog.SafeTitle())
 }
 
+// URL will return the path of the post relative to the site root, e.g. /posts/my-post
+func (blog *Post) URL() string {
+
+	// Use the path generated when the post was loaded
+	if blog.path != "" {
+		return blog.path
+	}
+	return "/posts/" + blog.SafeURL()
+}
+
+// IsUpdated will return true if the post was edited after it was created
+// Only an updated time set by the post counts as an edit, as the file modification time also
+// changes when the posts are copied or checked out. Any changes made within the updatedThreshold
+// of the creation time are ignored
+func (blog *Post) IsUpdated() bool {
+	return !blog.defaulted && blog.Updated.Sub(blog.Created) > updatedThreshold
+}
+
+// IsPublished will return true if the time is within the publishing window of the post
+func (blog *Post) IsPublished(now time.Time) bool {
+	if !blog.PublishAt.IsZero() && now.Before(blog.PublishAt) {
+		return false
+	}
+	return blog.ExpireAt.IsZero() || now.Before(blog.ExpireAt)
+}
+
+// Will return the earlier of next and the next time after now that the post is published or expires
+func (blog *Post) nextTransition(now, next time.Time) time.Time {
+	for _, t := range []time.Time{blog.PublishAt, blog.ExpireAt} {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	return next
+}
+
+// Permalink will return the absolute URL of the post under the base URL, e.g. http://www.example.com/posts/my-post
+func (blog *Post) Permalink(baseURL string) string {
+	return strings.TrimRight(baseURL, "/") + blog.URL()
+}
+
+// IsArchived will return true if the post was created more than the threshold ago (never if the threshold is not set)
+func (blog *Post) IsArchived(threshold time.Duration) bool {
+	return threshold > 0 && time.Since(blog.Created) > threshold
+}
+
+// LastModified will return when the post was last changed, which is the later of the updated
+// date and the modification time of the post file
+func (blog *Post) LastModified() time.Time {
+	if blog.modTime.After(blog.Updated) {
+		return blog.modTime
+	}
+	return blog.Updated
+}
+
+// WordCount will return the number of words within the body (excluding any HTML tags)
+func (blog *Post) WordCount() int {
+	return len(strings.Fields(stripTags(blog.Body)))
+}
+
+// ReadingTime will return the estimated number of minutes it takes to read the post
+func (blog *Post) ReadingTime() int {
+
+	// Based on an average reading speed of 200 words per minute
+	minutes := (blog.WordCount() + 199) / 200
+	if minutes < 1 {
+		minutes = 1
+	}
+	return minutes
+}
+
 // BodySafe will return the body as HTML (as the html template will automatically escape it by default)
 func (blog *Post) BodySafe() template.HTML {
 
@@ -113,6 +344,13 @@ func (blog *Post) BodySafe() template.HTML {
 	return template.HTML(blog.Body)
 }
 
+// ListingHTML will return the truncated body as HTML for use within the post listings
+func (blog *Post) ListingHTML() template.HTML {
+
+	// Return an HTML element
+	return template.HTML(blog.listing)
+}
+
 // New will create a new Blog serving content from the provided directory
 func New(configuration *Configuration) *Blog {
 
@@ -120,6 +358,9 @@ func New(configuration *Configuration) *Blog {
 	blog := &Blog{}
 	logger.Info("Creating '%s' blog", configuration.Title)
 	logger.Info("Loading posts from directory: %s", configuration.Postsdir)
+	for _, dir := range configuration.PostsDirs {
+		logger.Info("Loading posts from directory: %s", dir)
+	}
 	logger.Info("Loading templates from directory: %s", configuration.Templatesdir)
 	logger.Info("Serving assets from directory: %s", configuration.Assetsdir)
 
@@ -130,8 +371,7 @@ func New(configuration *Configuration) *Blog {
 // init resets the blog data
 func (blog *Blog) init(configuration *Configuration) *Blog {
 	blog.configuration = configuration
-	blog.posts = nil
-	blog.postMap = make(map[string]*Post)
+	blog.data = &postData{postMap: make(map[string]*Post), drafts: make(map[string]*Post)}
 
 	// Set the number of recent posts if it has not been set
 	if blog.configuration.NoOfRecentPosts == 0 {
@@ -139,14 +379,112 @@ func (blog *Blog) init(configuration *Configuration) *Blog {
 		blog.configuration.NoOfRecentPosts = 3
 	}
 
+	// Set the base path of the post routes if it has not been set
+	blog.configuration.PostsPath = strings.Trim(blog.configuration.PostsPath, "/")
+	if blog.configuration.PostsPath == "" {
+		blog.configuration.PostsPath = "posts"
+	}
+
+	// Set the Open Graph site name and locale if they have not been set
+	if blog.configuration.SiteName == "" {
+		blog.configuration.SiteName = blog.configuration.Title
+	}
+	if blog.configuration.Locale == "" {
+		blog.configuration.Locale = "en_US"
+	}
+
+	// Set the read more link text if it has not been set
+	if blog.configuration.ReadMoreText == "" {
+		blog.configuration.ReadMoreText = blog.message("readmore")
+	}
+
+	// Default the copyright to the current year
+	if blog.configuration.CopyrightYear == 0 {
+		blog.configuration.CopyrightYear = time.Now().Year()
+	}
+
+	// Only load the json post files by default
+	if len(blog.configuration.PostExtensions) == 0 {
+		blog.configuration.PostExtensions = []string{".json"}
+	}
+	for i, ext := range blog.configuration.PostExtensions {
+		if !strings.HasPrefix(ext, ".") {
+			blog.configuration.PostExtensions[i] = "." + ext
+		}
+	}
+
+	// Set the asset prefix if it has not been set (it must begin and end with a slash)
+	blog.configuration.AssetPrefix = strings.Trim(blog.configuration.AssetPrefix, "/")
+	if blog.configuration.AssetPrefix == "" {
+		blog.configuration.AssetPrefix = "assets"
+	}
+	blog.configuration.AssetPrefix = "/" + blog.configuration.AssetPrefix + "/"
+
+	// Set the read more marker if it has not been set
+	if blog.configuration.MoreMarker == "" {
+		blog.configuration.MoreMarker = "<!--more-->"
+	}
+
+	// Protect the admin routes by default
+	if len(blog.configuration.AdminPaths) == 0 {
+		blog.configuration.AdminPaths = []string{"/admin/"}
+	}
+
+	// Set the default CORS methods and headers for the API routes
+	if len(blog.configuration.CORSMethods) == 0 {
+		blog.configuration.CORSMethods = []string{"GET", "OPTIONS"}
+	}
+	if len(blog.configuration.CORSHeaders) == 0 {
+		blog.configuration.CORSHeaders = []string{"Content-Type", "X-API-Key"}
+	}
+
+	// Load the timezone that the dates will be displayed in
+	if blog.configuration.DisplayTimezone != "" {
+		location, err := time.LoadLocation(blog.configuration.DisplayTimezone)
+		if err != nil {
+			logger.Error("Cannot load display timezone %s: %s", blog.configuration.DisplayTimezone, err.Error())
+		} else {
+			blog.location = location
+		}
+	}
+
+	// Only the forwarding headers set by the trusted proxies are used to find the client IP
+	blog.trustedProxies = parseTrustedProxies(blog.configuration.TrustedProxies)
+
+	// Keep the subscribers in memory if no store has been set
+	if blog.configuration.Subscribers == nil {
+		blog.configuration.Subscribers = &MemorySubscriberStore{}
+	}
+
+	// Count the post views in memory if no counter has been set
+	if blog.configuration.Views == nil {
+		blog.configuration.Views = &MemoryViewCounter{}
+	}
+
+	// Use a tight throttle limit for the subscriptions
+	if blog.configuration.SubscribeLimit.Max == 0 {
+		blog.configuration.SubscribeLimit = ThrottleLimit{Max: 3, TTL: time.Minute}
+	}
+
+	// The HTML is left readable in development mode
+	if blog.configuration.MinifyHTML && !blog.configuration.DevelopmentMode {
+		blog.minifier = minify.New()
+		blog.minifier.AddFunc("text/html", html.Minify)
+	}
+
 	// // Set the default throttle limit
 	if blog.configuration.RequestHandlerLimit.Max == 0 {
 		logger.Warn("Setting request handler limit to default value of 1s")
 		blog.configuration.RequestHandlerLimit = ThrottleLimit{Max: 10, TTL: time.Second}
 	}
 
-	// Add the watcher for the post directory
-	updates := WatchPosts(configuration.Postsdir)
+	// Add the watcher for the post directory (the error is returned when the blog is started)
+	updates, err := watchPosts(blog.postsDirs()...)
+	if err != nil {
+		logger.Error("%s", err.Error())
+		blog.watchErr = err
+		return blog
+	}
 
 	// This is used to exit out of the current timer handlers
 	timerExit := make(chan bool)
@@ -182,6 +520,14 @@ func (blog *Blog) init(configuration *Configuration) *Blog {
 			}
 		}
 	}()
+
+	// Poll the post directories as well for the file systems that do not deliver events
+	if blog.configuration.PollInterval > 0 {
+
+		// The signature is taken now so that a change made before the first poll is not missed
+		last, _ := blog.postsSignature()
+		go blog.pollPosts(blog.configuration.PollInterval, last)
+	}
 	return blog
 }
 
@@ -192,78 +538,555 @@ func (blog *Blog) getTemplatePath(templateName string) string {
 	return path.Join(blog.configuration.Templatesdir, templateName)
 }
 
+// Will return the text of the message with the key, falling back to the default text (or the key itself)
+func (blog *Blog) message(key string) string {
+	if m, ok := blog.configuration.Messages[key]; ok {
+		return m
+	}
+	if m, ok := defaultMessages[key]; ok {
+		return m
+	}
+	return key
+}
+
+// Will convert the time into the display timezone (if one has been configured)
+func (blog *Blog) localTime(t time.Time) time.Time {
+	if blog.location == nil {
+		return t
+	}
+	return t.In(blog.location)
+}
+
+// Will format the time using the layout within the display timezone
+func (blog *Blog) formatDate(layout string, t time.Time) string {
+	return blog.localTime(t).Format(layout)
+}
+
+// Will return the route of the post listing, the individual posts are served beneath it
+func (blog *Blog) postsRoute() string {
+	return "/" + blog.configuration.PostsPath
+}
+
+// Will return the path of the post using the given form of its slug and the configured permalink style
+func (blog *Blog) postPath(post *Post, slug string) string {
+	if blog.configuration.PermalinkStyle == PermalinkDateSlug {
+		return blog.postsRoute() + "/" + post.Created.Format(permalinkDateLayout) + "/" + slug
+	}
+	return blog.postsRoute() + "/" + slug
+}
+
+// Will return the absolute URL for the path using the configured site URL
+func (blog *Blog) absoluteURL(p string) string {
+	if p == "" {
+		return ""
+	}
+
+	// Leave the path untouched if it is already absolute
+	if u, err := url.Parse(p); err == nil && u.IsAbs() {
+		return p
+	}
+	return strings.TrimRight(blog.configuration.SiteURL, "/") + "/" + strings.TrimLeft(p, "/")
+}
+
+// Will return the absolute URL for the image representing the post
+func (blog *Blog) postImage(post *Post) string {
+
+	// Fall back to the default image when the post does not have its own
+	if post.CoverImage != "" {
+		return blog.absoluteURL(post.CoverImage)
+	}
+	return blog.absoluteURL(blog.configuration.DefaultImage)
+}
+
 // Will read all the available posts from the file system
+// Any calls made while a load is in progress may have been made for changes that the load has
+// already missed, so they wait for a single follow-up load and share its result instead
+// The OnReload callback is called (outside of the lock) once the posts have been loaded
 func (blog *Blog) loadPosts() error {
+	blog.reloadMutex.Lock()
+	if blog.reloading != nil {
+		if blog.pending == nil {
+			blog.pending = &reload{done: make(chan struct{})}
+		}
+		pending := blog.pending
+		pending.waiting++
+		blog.reloadMutex.Unlock()
+		<-pending.done
+		return pending.err
+	}
+	current := &reload{done: make(chan struct{})}
+	blog.reloading = current
+	blog.reloadMutex.Unlock()
+
+	// Keep loading until no more calls were made during the previous load
+	var err error
+	for first := true; current != nil; first = false {
+		var posts Posts
+		posts, current.err = blog.readPosts()
+		if first {
+			err = current.err
+		}
+
+		// Release the waiting callers and start the follow-up load (if any)
+		blog.reloadMutex.Lock()
+		next := blog.pending
+		blog.reloading, blog.pending = next, nil
+		blog.reloadMutex.Unlock()
+		close(current.done)
+		if current.err == nil && blog.configuration.OnReload != nil {
+			blog.configuration.OnReload(posts)
+		}
+		if next != nil {
+			logger.Debug("Reloading posts for the %d calls made during the last load", next.waiting)
+		}
+		current = next
+	}
+	return err
+}
+
+// Will read the posts from the file system and swap them in, returning the posts that were loaded
+func (blog *Blog) readPosts() (Posts, error) {
 	mutex.Lock()
 	defer mutex.Unlock()
 
-	// Open the root application directory where the posts are stored
-	// Read in each file and generate the post and tag objects
-	fileInfos, err := ioutil.ReadDir(blog.configuration.Postsdir)
+	// Instrument the load (this is a no-op unless tracing has been enabled)
+	_, span := blog.startSpan(context.Background(), "loadPosts")
+	defer span.End()
+	start := time.Now()
+
+	// Locate all of the post files within the posts directories
+	paths, err := blog.postFiles()
 	if err != nil {
-		logger.Error("Cannot read the files from %s", blog.configuration.Postsdir)
-		return err
+		setSpanError(span, err)
+		return nil, err
+	}
+
+	// Any previously read files are only re-read if they have changed, unless a file
+	// has been removed in which case all of the files are read again
+	if blog.removedFiles(paths) {
+		blog.files = nil
 	}
+	files := make(map[string]*cachedPost, len(paths))
 
-	postsno := 0
-	blog.postMap = make(map[string]*Post)
+	// The posts are built up separately so the current posts can be read throughout the reload
+	postsno, parsed := 0, 0
+	newPosts := make([]*Post, 0, len(paths))
+	previous, added := blog.snapshot().postMap, 0
+	postMap := make(map[string]*Post)
+	drafts := make(map[string]*Post)
+	var loadErrors []error
+	now, next := time.Now(), time.Time{}
 	logger.Debug("Loading posts")
-	for _, fi := range fileInfos {
-
-		// Load the file (only .json files should be read)
-		if filepath.Ext(fi.Name()) == ".json" {
-			filePath := path.Join(blog.configuration.Postsdir, fi.Name())
-			fi, err := os.Open(filePath)
-			defer fi.Close()
-			if err == nil {
-
-				// Copy the file contents into the buffer
-				var b bytes.Buffer
-				_, err := b.ReadFrom(fi)
-				if err == nil {
-
-					// Create an empty post to copy the values into
-					var post Post
-					err := json.Unmarshal(b.Bytes(), &post)
-					if err == nil {
-
-						// Is there a post already with the same title?
-						for blog.postMap[post.SafeTitle()] != nil {
-
-							// Then we need to ensure that this post has a unique name
-							post.Title = fmt.Sprintf("%s-", post.Title)
-						}
+	for _, file := range paths {
+		stat, err := os.Stat(file)
+		if err != nil {
+			logger.Warn("Cannot read post %s: %s", file, err.Error())
+			loadErrors = append(loadErrors, &ParseError{File: file, Err: err})
+			continue
+		}
+		if max := blog.configuration.MaxPostFileSize; max > 0 && stat.Size() > max {
+			logger.Warn("Skipping post %s as it is larger than %d bytes", file, max)
+			continue
+		}
+		cached := blog.files[file]
+		if cached == nil || !cached.modTime.Equal(stat.ModTime()) || cached.size != stat.Size() {
+			post, err := blog.parsePost(file)
+			if err != nil {
+				logger.Warn("%s", err.Error())
+				loadErrors = append(loadErrors, err)
+				continue
+			}
+			cached = &cachedPost{modTime: stat.ModTime(), size: stat.Size(), post: *post}
+			parsed++
+		}
+		files[file] = cached
 
-						// Then the data was un-marshalled successfully and the post can be used
-						postsno++
-						post.FileName = fi.Name()
-						blog.postMap[post.SafeTitle()] = &post
-					}
-				}
+		// Each load works on its own copy of the post
+		post := cached.post
+
+		// Hide the posts outside of their publishing window, but reload when they change state
+		next = post.nextTransition(now, next)
+		if !post.IsPublished(now) {
+			continue
+		}
+
+		// Is there a post already with the same title?
+		slug := blog.slugify(post.Title)
+		if existing := postMap[slug]; existing != nil || drafts[slug] != nil {
+			if existing == nil {
+				existing = drafts[slug]
 			}
+			logger.Warn("Posts %s and %s have the same slug '%s'", existing.FileName, post.FileName, slug)
 		}
-	}
-	logger.Debug("Finished loading %d posts", postsno)
+		for postMap[slug] != nil || drafts[slug] != nil {
 
-	// Now sort the posts into the array
-	newPosts := make([]*Post, postsno)
-	i := 0
-	for _, v := range blog.postMap {
-		newPosts[i] = v
-		i++
+			// Then we need to ensure that this post has a unique name
+			post.Title = fmt.Sprintf("%s-", post.Title)
+			slug += "-"
+		}
+		post.slug = slug
+		post.path = blog.postPath(&post, post.SafeURL())
+
+		// The drafts are kept separately so they are not listed (except in development mode
+		// where they are listed along with the other posts so they can be previewed inline)
+		if post.Draft {
+			drafts[slug] = &post
+			if !blog.configuration.DevelopmentMode {
+				continue
+			}
+		}
+
+		// Then the data was un-marshalled successfully and the post can be used
+		postsno++
+		postMap[slug] = &post
+		newPosts = append(newPosts, &post)
+		if previous[slug] == nil {
+			added++
+		}
 	}
+	blog.files = files
+
+	// Forget the lazily loaded bodies of the files that have since changed or been removed
+	blog.bodies.Range(func(k, v interface{}) bool {
+		key := k.(bodyKey)
+		if cached := files[key.file]; cached == nil || !cached.modTime.Equal(key.modTime) {
+			blog.bodies.Delete(key)
+		}
+		return true
+	})
+	blog.parsed += parsed
+	logger.Debug("Parsed %d changed post files", parsed)
+	logger.Debug("Finished loading %d posts", postsno)
 
 	// Sort the array
 	sort.Sort(Posts(newPosts))
-	blog.posts = newPosts
-	return nil
+
+	// Also order the posts by when they were last updated
+	updated := make(Posts, len(newPosts))
+	copy(updated, newPosts)
+	sort.SliceStable(updated, func(i, j int) bool { return updated[i].Updated.After(updated[j].Updated) })
+
+	// Log how the posts have changed since the previous load (every post that was not
+	// added was also within the previous posts, so the rest of those have been removed)
+	removed := len(previous) - (postsno - added)
+	logger.Info("Loaded %d posts in %s (%d added, %d removed)", postsno, time.Since(start), added, removed)
+
+	// Swap in the new posts
+	blog.setSnapshot(&postData{posts: newPosts, postMap: postMap, drafts: drafts, updated: updated, errors: loadErrors})
+	blog.schedule(next)
+	return newPosts, nil
+}
+
+// Will schedule the posts to be reloaded at the given time, replacing any existing schedule
+func (blog *Blog) schedule(at time.Time) {
+	if blog.scheduled != nil {
+		blog.scheduled.Stop()
+		blog.scheduled = nil
+	}
+	if !at.IsZero() {
+		blog.scheduled = time.AfterFunc(time.Until(at), func() {
+			logger.Info("Reloading posts for scheduled publishing")
+			blog.loadPosts()
+		})
+	}
+}
+
+// Will return true if any of the previously read files are no longer present
+func (blog *Blog) removedFiles(paths []string) bool {
+	present := make(map[string]bool, len(paths))
+	for _, file := range paths {
+		present[file] = true
+	}
+	for file := range blog.files {
+		if !present[file] {
+			return true
+		}
+	}
+	return false
+}
+
+// Will read the post from the file and prepare it to be cached between loads
+func (blog *Blog) parsePost(file string) (*Post, error) {
+	post, err := readPost(file)
+	if err != nil {
+		return nil, err
+	}
+	blog.checkDates(post, time.Now())
+	post.listing = blog.listingBody(post)
+
+	// Only the metadata is kept in memory when the bodies are loaded on demand
+	if blog.configuration.LazyBodies {
+		post.Body = ""
+	}
+	return post, nil
+}
+
+// Will warn about a created or updated date in the future (most likely a typo) as it would be
+// reported as the last update of the site, clamping the date to now if configured
+func (blog *Blog) checkDates(post *Post, now time.Time) {
+	limit := now.Add(futureDateSkew)
+	for _, date := range []struct {
+		name  string
+		value *time.Time
+	}{{"created", &post.Created}, {"updated", &post.Updated}} {
+		if date.value.After(limit) {
+			logger.Warn("Post %s has a %s date in the future: %s", post.FileName, date.name, date.value.Format(time.RFC3339))
+			if blog.configuration.ClampFutureDates {
+				*date.value = now
+			}
+		}
+	}
+}
+
+// Will return the current snapshot of the posts
+// A reload swaps in a new snapshot rather than changing the current one, so the snapshot can still
+// be read once the lock is released. The posts within it are shared between all of the requests
+// and must be copied before they are changed (see loadBody)
+func (blog *Blog) snapshot() *postData {
+	blog.dataMutex.RLock()
+	defer blog.dataMutex.RUnlock()
+	return blog.data
+}
+
+// Will replace the current snapshot of the posts
+func (blog *Blog) setSnapshot(data *postData) {
+	blog.dataMutex.Lock()
+	defer blog.dataMutex.Unlock()
+	blog.data = data
+}
+
+// LoadErrors will return the errors of the post files that were skipped by the last load
+// The files that could not be parsed are returned as a *ParseError
+func (blog *Blog) LoadErrors() []error {
+	return blog.snapshot().errors
+}
+
+// RecentlyUpdated will return the n most recently updated posts, newest first
+func (blog *Blog) RecentlyUpdated(n int) Posts {
+	updated := blog.snapshot().updated
+	if len(updated) > n {
+		updated = updated[:n]
+	}
+	return updated
+}
+
+// PostsInRange will return the posts created between the from and to times (inclusive)
+// The posts are returned in the same order as they are listed, newest first
+func (blog *Blog) PostsInRange(from, to time.Time) Posts {
+	var posts Posts
+	for _, post := range blog.snapshot().posts {
+		if !post.Created.Before(from) && !post.Created.After(to) {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
+
+// Will reload the posts whenever the signature of the posts directories changes from the last signature
+func (blog *Blog) pollPosts(interval time.Duration, last string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		signature, err := blog.postsSignature()
+		if err != nil || signature == last {
+			continue
+		}
+		last = signature
+		logger.Warn("Post directory has changed")
+		blog.loadPosts()
+	}
+}
+
+// Will return a signature of the post files that changes when any file is added, removed or modified
+func (blog *Blog) postsSignature() (string, error) {
+	paths, err := blog.postFiles()
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, file := range paths {
+		if stat, err := os.Stat(file); err == nil {
+			fmt.Fprintf(h, "%s %d %d\n", file, stat.ModTime().UnixNano(), stat.Size())
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Will return the directories that the posts are loaded from
+func (blog *Blog) postsDirs() []string {
+	return append([]string{blog.configuration.Postsdir}, blog.configuration.PostsDirs...)
 }
 
-// WatchPosts will create a watcher of the directory
-func WatchPosts(directory string) chan Event {
+// Will return the paths of all the post files within the posts directories
+func (blog *Blog) postFiles() ([]string, error) {
+	var files []string
+	for _, dir := range blog.postsDirs() {
+
+		// Walk the application directory where the posts are stored (including subdirectories)
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			// Only the files with a post extension should be read
+			if !d.IsDir() && blog.isPostFile(d.Name()) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			logger.Error("Cannot read the files from %s", dir)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("%w: %s", ErrPostsDirNotFound, dir)
+			}
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// Will return true if the file has one of the configured post extensions
+func (blog *Blog) isPostFile(name string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range blog.configuration.PostExtensions {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Will read the post from the file at the given path
+func readPost(filePath string) (*Post, error) {
+	fi, err := os.Open(filePath)
+	if err != nil {
+		return nil, &ParseError{File: filePath, Err: err}
+	}
+	defer fi.Close()
+
+	// Copy the file contents into the buffer
+	var b bytes.Buffer
+	if _, err := b.ReadFrom(fi); err != nil {
+		return nil, &ParseError{File: filePath, Err: err}
+	}
+
+	// Create an empty post to copy the values into
+	post := &Post{}
+	if err := json.Unmarshal(b.Bytes(), post); err != nil {
+		return nil, &ParseError{File: filePath, Err: err}
+	}
+	post.FileName = fi.Name()
+	post.statAttachments()
+
+	// Default the updated time to when the file was last modified
+	if stat, err := fi.Stat(); err == nil {
+		post.modTime = stat.ModTime()
+	}
+	if post.Updated.IsZero() {
+		post.defaulted = true
+		if !post.modTime.IsZero() {
+			post.Updated = post.modTime
+		} else {
+			post.Updated = post.Created
+		}
+	}
+	return post, nil
+}
+
+// bodyKey identifies the version of the post file that a lazily loaded body was read from
+type bodyKey struct {
+	file    string
+	modTime time.Time
+}
+
+// Will return the post with its body, reading the body if it was not loaded along with the metadata
+// The posts within the snapshot are never modified, so a copy of the post holding the body is returned
+func (blog *Blog) loadBody(post *Post) (*Post, error) {
+	if !blog.configuration.LazyBodies {
+		return post, nil
+	}
+
+	// The body is cached once it has been read (the same file may be read twice by concurrent
+	// requests but that is harmless as the result is the same)
+	key := bodyKey{file: post.FileName, modTime: post.modTime}
+	body, ok := blog.bodies.Load(key)
+	if !ok {
+		full, err := readPost(post.FileName)
+		if err != nil {
+			return nil, err
+		}
+		body = full.Body
+		blog.bodies.Store(key, body)
+	}
+	loaded := *post
+	loaded.Body = body.(string)
+	return &loaded, nil
+}
+
+// Will return the body that should be displayed for the post within the listings
+func (blog *Blog) listingBody(post *Post) string {
+
+	// Everything before the marker is used as the excerpt
+	if i := strings.Index(post.Body, blog.configuration.MoreMarker); i >= 0 {
+		return post.Body[:i]
+	}
+
+	// Otherwise fall back to the summary or the first paragraph of the body
+	if post.Summary != "" {
+		return post.Summary
+	}
+	if i := strings.Index(post.Body, "</p>"); i >= 0 {
+		return post.Body[:i+len("</p>")]
+	}
+	return post.Body
+}
+
+// Will remove all of the HTML tags from the text
+func stripTags(text string) string {
+	var b bytes.Buffer
+	inTag := false
+	for _, r := range text {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>' && inTag:
+			inTag = false
+
+			// Ensure the words either side of the tag remain separate
+			b.WriteRune(' ')
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// WatchPosts will create a watcher of the directories (including all of their subdirectories)
+func WatchPosts(directories ...string) chan Event {
+	updates, err := watchPosts(directories...)
+	if err != nil {
+		logger.Fatal("%s", err.Error())
+	}
+	return updates
+}
+
+// Will create a watcher of the directories, returning an error if any of them cannot be watched
+func watchPosts(directories ...string) (chan Event, error) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
-		logger.Fatal("Error creating watcher: %s", err.Error())
+		return nil, fmt.Errorf("error creating watcher: %w", err)
+	}
+
+	// Attempt to watch each of the directories before any events are handled
+	for _, directory := range directories {
+		if err := watchTree(watcher, directory); err != nil {
+			watcher.Close()
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("%w: %s", ErrPostsDirNotFound, directory)
+			}
+			return nil, fmt.Errorf("error creating directory watcher: %w", err)
+		}
 	}
 
 	// Create the channel where events are pushed
@@ -272,6 +1095,15 @@ func WatchPosts(directory string) chan Event {
 		for {
 			select {
 			case event := <-watcher.Events:
+
+				// Any new subdirectories also need to be watched
+				if event.Op&fsnotify.Create == fsnotify.Create {
+					if fi, err := os.Stat(event.Name); err == nil && fi.IsDir() {
+						if err := watchTree(watcher, event.Name); err != nil {
+							logger.Error("Error creating directory watcher: %s", err.Error())
+						}
+					}
+				}
 				if event.Op&fsnotify.Write == fsnotify.Write {
 
 					// Push the event onto the queue to get the system to update the posts
@@ -280,11 +1112,18 @@ func WatchPosts(directory string) chan Event {
 			}
 		}
 	}()
+	return updates, nil
+}
 
-	// Attempt to watch the directory
-	err = watcher.Add(directory)
-	if err != nil {
-		logger.Fatal("Error creating directory watcher: %s", err.Error())
-	}
-	return updates
+// Will add the directory and all of its subdirectories to the watcher
+func watchTree(watcher *fsnotify.Watcher, directory string) error {
+	return filepath.WalkDir(directory, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return watcher.Add(p)
+		}
+		return nil
+	})
 }
@@ -0,0 +1,540 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The minimal theme used to render the pages within the tests
+var testTemplates = map[string]string{
+	"header.html":   `{{define "header"}}<title>{{.Title}}</title>{{if .NoIndex}}<meta name="robots" content="noindex">{{end}}{{end}}`,
+	"footer.html":   `{{define "footer"}}<footer></footer>{{end}}`,
+	"home.html":     `{{template "header" .}}{{range .Posts}}<h2>{{.Title}}</h2>{{.BodySafe}}{{end}}`,
+	"post.html":     `{{template "header" .}}{{with .Post}}<h1>{{.Title}}</h1>{{.BodySafe}}{{end}}`,
+	"posts.html":    `{{template "header" .}}{{range .Posts}}<h2>{{.Title}}</h2>{{end}}`,
+	"notfound.html": `{{template "header" .}}{{.Message}}`,
+	"about.html":    `{{template "header" .}}about`,
+}
+
+// Will write the files into the directory
+func writeFiles(t testing.TB, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Will create a blog serving the posts (file name -> contents) from a temporary directory
+// The configuration can be changed before the posts and templates are loaded
+func newTestBlog(t testing.TB, posts map[string]string, configure func(*Configuration)) *Blog {
+	t.Helper()
+	configuration := &Configuration{Title: "Test", Postsdir: t.TempDir(), Templatesdir: t.TempDir(), Assetsdir: t.TempDir()}
+	writeFiles(t, configuration.Postsdir, posts)
+	writeFiles(t, configuration.Templatesdir, testTemplates)
+	if configure != nil {
+		configure(configuration)
+	}
+	blog := New(configuration)
+	if err := blog.loadPosts(); err != nil {
+		t.Fatal(err)
+	}
+	if err := blog.loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+	return blog
+}
+
+// Will return the files of n posts titled "Post 1" to "Post n", each created a day after the previous
+func numberedPosts(n int) map[string]string {
+	posts := make(map[string]string, n)
+	for i := 1; i <= n; i++ {
+		posts[fmt.Sprintf("post%d.json", i)] = fmt.Sprintf(`{"Title": "Post %d", "Body": "<p>Body %d</p>", "Created": "%s"}`,
+			i, i, time.Date(2013, 6, i, 0, 0, 0, 0, time.UTC).Format(time.RFC3339))
+	}
+	return posts
+}
+
+// Will replace the theme template used by the blog, e.g. to render the page data being tested
+func setTemplate(t testing.TB, blog *Blog, name, text string) {
+	t.Helper()
+	writeFiles(t, blog.configuration.Templatesdir, map[string]string{name: text})
+	if err := blog.loadTemplates(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Will make a GET request to the handler rendering the template and return the response
+func get(blog *Blog, handler func(http.ResponseWriter, *http.Request, *Blog, string), template, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", path, nil), blog, template)
+	return w
+}
+
+func TestLazyBodies(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Summary": "A summary", "Body": "<p>The body</p>"}`,
+	}, func(c *Configuration) {
+		c.LazyBodies = true
+	})
+	post := blog.snapshot().postMap["hello-world"]
+	if post == nil {
+		t.Fatal("expected the post to be loaded")
+	}
+	if post.Body != "" {
+		t.Errorf("expected only the metadata to be loaded, got the body %q", post.Body)
+	}
+
+	// The body is read when the post is viewed
+	w := httptest.NewRecorder()
+	viewPostHandler(w, httptest.NewRequest("GET", "/posts/hello-world", nil), blog, "post.html")
+	if !strings.Contains(w.Body.String(), "<p>The body</p>") {
+		t.Errorf("expected the body to be rendered, got %q", w.Body.String())
+	}
+
+	// The post within the snapshot is never modified
+	if post.Body != "" {
+		t.Errorf("expected the snapshot post to be unchanged, got the body %q", post.Body)
+	}
+}
+
+func TestLazyBodiesConcurrentRequests(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	}, func(c *Configuration) {
+		c.LazyBodies = true
+	})
+
+	// Render the listing (which reads the bodies) while the post is being viewed
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			viewHomeHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), blog, "home.html")
+		}()
+		go func() {
+			defer wg.Done()
+			viewPostHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/posts/hello-world", nil), blog, "post.html")
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReloadConcurrentReads(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>", "Created": "2013-06-01T00:00:00Z"}`,
+		"other.json": `{"Title": "Other Post", "Body": "<p>Other</p>", "Created": "2013-07-01T00:00:00Z"}`,
+	}, nil)
+
+	// Keep changing the posts and reloading them while they are being read
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			modTime := time.Now().Add(time.Duration(i) * time.Second)
+			if err := os.Chtimes(filepath.Join(blog.configuration.Postsdir, "hello.json"), modTime, modTime); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := blog.loadPosts(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				w := httptest.NewRecorder()
+				viewPostHandler(w, httptest.NewRequest("GET", "/posts/hello-world", nil), blog, "post.html")
+				if !strings.Contains(w.Body.String(), "<p>The body</p>") {
+					t.Errorf("expected the post to be served throughout the reloads, got %q", w.Body.String())
+				}
+				viewHomeHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), blog, "home.html")
+				blog.RecentlyUpdated(1)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestReloadOnlyParsesChangedFiles(t *testing.T) {
+	posts := map[string]string{}
+	for i := 0; i < 10; i++ {
+		posts[fmt.Sprintf("post%d.json", i)] = fmt.Sprintf(`{"Title": "Post %d", "Body": "<p>Body</p>"}`, i)
+	}
+	blog := newTestBlog(t, posts, nil)
+	if blog.parsed != len(posts) {
+		t.Fatalf("expected %d files to be parsed by the first load, got %d", len(posts), blog.parsed)
+	}
+
+	// Nothing has changed
+	if err := blog.loadPosts(); err != nil {
+		t.Fatal(err)
+	}
+	if blog.parsed != len(posts) {
+		t.Errorf("expected no files to be parsed when nothing changed, got %d", blog.parsed-len(posts))
+	}
+
+	// Only the touched file is read again
+	modTime := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(blog.configuration.Postsdir, "post3.json"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := blog.loadPosts(); err != nil {
+		t.Fatal(err)
+	}
+	if parsed := blog.parsed - len(posts); parsed != 1 {
+		t.Errorf("expected only the changed file to be parsed, got %d", parsed)
+	}
+	if len(blog.snapshot().posts) != len(posts) {
+		t.Errorf("expected %d posts, got %d", len(posts), len(blog.snapshot().posts))
+	}
+}
+
+func TestConcurrentReloadsAreCoalesced(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	}, nil)
+	var loads []Posts
+	blog.configuration.OnReload = func(posts Posts) {
+		loads = append(loads, posts)
+	}
+
+	// Hold the first load until all of the other calls have been made
+	mutex.Lock()
+	const calls = 10
+	errs := make(chan error, calls)
+	go func() { errs <- blog.loadPosts() }()
+	waitFor(t, blog, func() bool { return blog.reloading != nil })
+	for i := 1; i < calls; i++ {
+		go func() { errs <- blog.loadPosts() }()
+	}
+	waitFor(t, blog, func() bool { return blog.pending != nil && blog.pending.waiting == calls-1 })
+
+	// The first load has already missed this change so the other calls must not share its result
+	writeFiles(t, blog.configuration.Postsdir, map[string]string{
+		"other.json": `{"Title": "Other Post", "Body": "<p>Other</p>"}`,
+	})
+	mutex.Unlock()
+	for i := 0; i < calls; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the first load and a single follow-up load were run
+	if len(loads) != 2 {
+		t.Fatalf("expected the posts to be loaded twice, got %d", len(loads))
+	}
+	if len(loads[1]) != 2 || blog.snapshot().postMap["other-post"] == nil {
+		t.Errorf("expected the follow-up load to include the new post, got %d posts", len(loads[1]))
+	}
+}
+
+// Will wait until the condition (checked while holding the reload lock) is true
+func waitFor(t *testing.T, blog *Blog, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		blog.reloadMutex.Lock()
+		done := condition()
+		blog.reloadMutex.Unlock()
+		if done {
+			return
+		}
+	}
+	t.Fatal("timed out waiting for the reloads")
+}
+
+// recordLogger keeps the messages that are logged so that the tests can check them
+type recordLogger struct {
+	sync.Mutex
+	messages []string
+}
+
+func (l *recordLogger) record(level, format string, args ...interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	l.messages = append(l.messages, level+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Debug(format string, args ...interface{}) { l.record("DEBUG", format, args...) }
+func (l *recordLogger) Info(format string, args ...interface{})  { l.record("INFO", format, args...) }
+func (l *recordLogger) Warn(format string, args ...interface{})  { l.record("WARN", format, args...) }
+func (l *recordLogger) Error(format string, args ...interface{}) { l.record("ERROR", format, args...) }
+func (l *recordLogger) Fatal(format string, args ...interface{}) { l.record("FATAL", format, args...) }
+
+// Will return the logged messages that contain all of the text
+func (l *recordLogger) find(text ...string) []string {
+	l.Lock()
+	defer l.Unlock()
+	var found []string
+	for _, message := range l.messages {
+		matches := true
+		for _, s := range text {
+			matches = matches && strings.Contains(message, s)
+		}
+		if matches {
+			found = append(found, message)
+		}
+	}
+	return found
+}
+
+// The messages logged by the blog, it replaces the logger before any of the tests start
+// as the goroutines started by the earlier tests can still be logging
+var logs = &recordLogger{}
+
+func TestMain(m *testing.M) {
+	logger = logs
+	os.Exit(m.Run())
+}
+
+// Will forget the messages logged before the test so that only its own messages are checked
+func recordLogs(t *testing.T) *recordLogger {
+	t.Helper()
+	logs.Lock()
+	logs.messages = nil
+	logs.Unlock()
+	return logs
+}
+
+func BenchmarkLoadPosts(b *testing.B) {
+	posts := make(map[string]string, 1000)
+	for i := 0; i < 1000; i++ {
+		posts[fmt.Sprintf("post%04d.json", i)] = fmt.Sprintf(`{"Title": "Post %d", "Summary": "The summary of post %d",
+			"Body": "<p>%s</p>", "Created": "2013-06-01T00:00:00Z"}`, i, i, strings.Repeat("Lorem ipsum dolor sit amet. ", 50))
+	}
+	blog := newTestBlog(b, posts, nil)
+
+	// Every file is read again when the cached files are forgotten
+	for _, bench := range []struct {
+		name   string
+		cached bool
+	}{{"1000 posts", false}, {"1000 unchanged posts", true}} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !bench.cached {
+					blog.files = nil
+				}
+				if err := blog.loadPosts(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiplePostsDirs(t *testing.T) {
+	extra := t.TempDir()
+	writeFiles(t, extra, map[string]string{"extra.json": `{"Title": "Extra Post", "Body": "<p>Extra</p>"}`})
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	}, func(c *Configuration) {
+		c.PostsDirs = []string{extra}
+	})
+	for _, slug := range []string{"hello-world", "extra-post"} {
+		if blog.snapshot().postMap[slug] == nil {
+			t.Errorf("expected the post %s to be loaded", slug)
+		}
+	}
+	if w := get(blog, viewPostsHandler, "posts.html", "/posts"); !strings.Contains(w.Body.String(), "<h2>Extra Post</h2>") {
+		t.Errorf("expected the post from the extra directory to be listed, got %q", w.Body.String())
+	}
+}
+
+func TestNestedPostsDirs(t *testing.T) {
+	var nested string
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		nested = filepath.Join(c.Postsdir, "2013", "06")
+		if err := os.MkdirAll(nested, 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, nested, map[string]string{"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`})
+	})
+	if blog.snapshot().postMap["hello-world"] == nil {
+		t.Fatal("expected the post within the nested directory to be loaded")
+	}
+
+	// A write within the nested directory is reported as an update of the posts
+	updates, err := watchPosts(blog.configuration.Postsdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, nested, map[string]string{"other.json": `{"Title": "Other Post", "Body": "<p>Other</p>"}`})
+	select {
+	case event := <-updates:
+		if event.Op != Update {
+			t.Errorf("expected an update, got %v", event.Op)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the write to be reported")
+	}
+}
+
+func TestPostExtensions(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"json.json":    `{"Title": "Json Post"}`,
+		"post.post":    `{"Title": "Post Post"}`,
+		"upper.POST":   `{"Title": "Upper Post"}`,
+		"notes.txt":    `{"Title": "Text Post"}`,
+		"backup.json~": `{"Title": "Backup Post"}`,
+	}, func(c *Configuration) {
+		c.PostExtensions = []string{"post", ".json"}
+	})
+	loaded := map[string]bool{}
+	for slug := range blog.snapshot().postMap {
+		loaded[slug] = true
+	}
+	for slug, expected := range map[string]bool{"json-post": true, "post-post": true, "upper-post": true, "text-post": false, "backup-post": false} {
+		if loaded[slug] != expected {
+			t.Errorf("%s: expected loaded to be %t", slug, expected)
+		}
+	}
+}
+
+func TestPostsInRange(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(5), nil)
+	day := func(d int) time.Time { return time.Date(2013, 6, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name     string
+		from, to time.Time
+		titles   string
+	}{
+		{"inclusive boundaries", day(2), day(4), "Post 4, Post 3, Post 2"},
+		{"single day", day(3), day(3), "Post 3"},
+		{"empty range", day(10), day(20), ""},
+		{"reversed range", day(4), day(2), ""},
+	}
+	for _, test := range tests {
+		var titles []string
+		for _, post := range blog.PostsInRange(test.from, test.to) {
+			titles = append(titles, post.Title)
+		}
+		if joined := strings.Join(titles, ", "); joined != test.titles {
+			t.Errorf("%s: expected %q, got %q", test.name, test.titles, joined)
+		}
+	}
+}
+
+func TestPollPosts(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(1), func(c *Configuration) {
+		c.PollInterval = 10 * time.Millisecond
+	})
+
+	// The file system events are debounced for far longer than the wait, so only the polling can find it
+	writeFiles(t, blog.configuration.Postsdir, map[string]string{"new.json": `{"Title": "New Post", "Body": "<p>Body</p>"}`})
+	waitFor(t, blog, func() bool { return blog.snapshot().postMap["new-post"] != nil })
+}
+
+func TestPublishingWindow(t *testing.T) {
+	future, past := time.Now().Add(time.Hour).Format(time.RFC3339), time.Now().Add(-time.Hour).Format(time.RFC3339)
+	blog := newTestBlog(t, map[string]string{
+		"current.json":   `{"Title": "Current", "Body": "<p>Body</p>", "PublishAt": "` + past + `", "ExpireAt": "` + future + `"}`,
+		"scheduled.json": `{"Title": "Scheduled", "Body": "<p>Body</p>", "PublishAt": "` + future + `"}`,
+		"expired.json":   `{"Title": "Expired", "Body": "<p>Body</p>", "ExpireAt": "` + past + `"}`,
+	}, nil)
+	if page := get(blog, viewPostsHandler, "posts.html", "/posts").Body.String(); page != "<title>Test</title><h2>Current</h2>" {
+		t.Errorf("expected only the published post to be listed, got %q", page)
+	}
+	for _, slug := range []string{"scheduled", "expired"} {
+		if w := get(blog, viewPostHandler, "post.html", "/posts/"+slug); w.Header().Get("Location") != "/notfound" {
+			t.Errorf("%s: expected the post not to be found, got %d %q", slug, w.Code, w.Body.String())
+		}
+	}
+	if w := get(blog, viewPostHandler, "post.html", "/posts/current"); w.Code != http.StatusOK {
+		t.Errorf("expected the published post to be found, got %d", w.Code)
+	}
+}
+
+func TestRecentlyUpdated(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"a.json": `{"Title": "A", "Created": "2013-06-01T00:00:00Z", "Updated": "2013-06-10T00:00:00Z"}`,
+		"b.json": `{"Title": "B", "Created": "2013-06-03T00:00:00Z", "Updated": "2013-06-04T00:00:00Z"}`,
+		"c.json": `{"Title": "C", "Created": "2013-06-05T00:00:00Z", "Updated": "2013-06-06T00:00:00Z"}`,
+	}, nil)
+	titles := func(posts Posts) string {
+		var names []string
+		for _, post := range posts {
+			names = append(names, post.Title)
+		}
+		return strings.Join(names, " ")
+	}
+	if created := titles(blog.snapshot().posts); created != "C B A" {
+		t.Errorf("expected the posts ordered by creation, got %s", created)
+	}
+	if updated := titles(blog.RecentlyUpdated(2)); updated != "A C" {
+		t.Errorf("expected the most recently updated posts, got %s", updated)
+	}
+	if updated := titles(blog.RecentlyUpdated(10)); updated != "A C B" {
+		t.Errorf("expected all of the posts ordered by update, got %s", updated)
+	}
+}
+
+func TestSlugCollisionWarning(t *testing.T) {
+	logs := recordLogs(t)
+	blog := newTestBlog(t, map[string]string{
+		"first.json":  `{"Title": "Hello World", "Created": "2013-06-01T00:00:00Z"}`,
+		"second.json": `{"Title": "Hello World", "Created": "2013-06-02T00:00:00Z"}`,
+	}, nil)
+	if warnings := logs.find("WARN", "first.json", "second.json", "'hello-world'"); len(warnings) != 1 {
+		t.Errorf("expected a warning naming both files, got %v", logs.find("WARN"))
+	}
+
+	// Both posts are still served under unique slugs
+	if data := blog.snapshot(); len(data.posts) != 2 || data.postMap["hello-world"] == nil || data.postMap["hello-world-"] == nil {
+		t.Errorf("expected both posts to be loaded with unique slugs, got %d posts", len(data.posts))
+	}
+}
+
+func TestMaxPostFileSize(t *testing.T) {
+	logs := recordLogs(t)
+	posts := numberedPosts(2)
+	posts["large.json"] = `{"Title": "Large", "Body": "<p>` + strings.Repeat("word ", 100) + `</p>"}`
+	blog := newTestBlog(t, posts, func(c *Configuration) {
+		c.MaxPostFileSize = 200
+	})
+	if data := blog.snapshot(); len(data.posts) != 2 || data.postMap["large"] != nil {
+		t.Errorf("expected only the smaller posts to be loaded, got %d posts", len(data.posts))
+	}
+	if warnings := logs.find("WARN", "large.json"); len(warnings) != 1 {
+		t.Errorf("expected a warning for the skipped file, got %v", logs.find("WARN"))
+	}
+}
+
+func TestReloadLogsChanges(t *testing.T) {
+	logs := recordLogs(t)
+	blog := newTestBlog(t, numberedPosts(2), nil)
+	if found := logs.find("INFO", "Loaded 2 posts", "(2 added, 0 removed)"); len(found) != 1 {
+		t.Errorf("expected the first load to add every post, got %v", logs.find("Loaded"))
+	}
+
+	// Add a post and remove another
+	writeFiles(t, blog.configuration.Postsdir, map[string]string{"post3.json": numberedPosts(3)["post3.json"]})
+	if err := os.Remove(filepath.Join(blog.configuration.Postsdir, "post1.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := blog.loadPosts(); err != nil {
+		t.Fatal(err)
+	}
+	if found := logs.find("INFO", "Loaded 2 posts", "(1 added, 1 removed)"); len(found) != 1 {
+		t.Errorf("expected the reload to log the changes, got %v", logs.find("Loaded"))
+	}
+}
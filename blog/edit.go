@@ -0,0 +1,207 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The maximum size of a post submitted to the API if no maximum post file size has been set
+const maxPostRequestSize = 1 << 20
+
+// Will decode and validate the post submitted within the body of the request
+func (blog *Blog) decodePost(w http.ResponseWriter, r *http.Request) (*Post, error) {
+	limit := int64(maxPostRequestSize)
+	if blog.configuration.MaxPostFileSize > 0 {
+		limit = blog.configuration.MaxPostFileSize
+	}
+	post := &Post{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(post); err != nil {
+		return nil, err
+	}
+	post.Title = strings.TrimSpace(post.Title)
+	if post.Title == "" {
+		return nil, errors.New("the title is required")
+	}
+
+	// The attachments cannot be used to download the files outside of the posts directories
+	for _, attachment := range post.Attachments {
+		if _, err := post.attachmentPath(attachment); err != nil {
+			return nil, err
+		}
+	}
+	return post, nil
+}
+
+// Will write the post to the file as JSON, the file is only created if it does not exist when exclusive is set
+func writePostFile(file string, post *Post, exclusive bool) error {
+
+	// The file name is always taken from the location of the file when it is read
+	saved := *post
+	saved.FileName = ""
+	b, err := json.MarshalIndent(&saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if exclusive {
+		flag |= os.O_EXCL
+	}
+	f, err := os.OpenFile(file, flag, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Handles the requests to the collection of posts, e.g. POST /api/posts to create a post
+func apiPostsHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !blog.requireAdmin(w, r) {
+		return
+	}
+	post, err := blog.decodePost(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The slug must be unique and usable as the name of the file
+	slug := blog.slugify(post.Title)
+	data := blog.snapshot()
+	if data.postMap[slug] != nil || data.drafts[slug] != nil {
+		writeJSONError(w, http.StatusConflict, "a post with the same slug already exists")
+		return
+	}
+	if strings.ContainsAny(slug, `/\`) || strings.Trim(slug, ".") == "" {
+		writeJSONError(w, http.StatusBadRequest, "the title cannot be used as a file name")
+		return
+	}
+	if post.Created.IsZero() {
+		post.Created = time.Now()
+	}
+	if post.Updated.IsZero() {
+		post.Updated = post.Created
+	}
+
+	// Write the new file (using an extension that is loaded as a post) and then reload so the post goes live
+	file := filepath.Join(blog.configuration.Postsdir, slug+blog.configuration.PostExtensions[0])
+	if err := writePostFile(file, post, true); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			writeJSONError(w, http.StatusConflict, "a post with the same file name already exists")
+			return
+		}
+		logger.Error("Cannot write post %s: %s", file, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, "cannot write post")
+		return
+	}
+	if err := blog.loadPosts(); err != nil {
+		logger.Error("Could not reload posts: %s", err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Ensure the post was loaded (unless it is not published yet) before reporting where it is
+	data = blog.snapshot()
+	if data.postMap[slug] == nil && data.drafts[slug] == nil && post.IsPublished(time.Now()) {
+		logger.Error("The new post %s was not loaded", file)
+		os.Remove(file)
+		writeJSONError(w, http.StatusInternalServerError, "the post could not be loaded")
+		return
+	}
+	post.slug = slug
+	post.path = blog.postPath(post, post.SafeURL())
+	w.Header().Set("Location", post.URL())
+	writeJSON(w, http.StatusCreated, blog.postMeta(post))
+}
+
+// Will return true if the file is within one of the posts directories
+func (blog *Blog) inPostsDirs(file string) bool {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return false
+	}
+	for _, dir := range blog.postsDirs() {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, file); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handles the requests to replace a post, e.g. PUT /api/posts/{slug}
+func apiUpdatePostHandler(w http.ResponseWriter, r *http.Request, blog *Blog, post *Post) {
+	if !blog.inPostsDirs(post.FileName) {
+		logger.Error("Refusing to update post %s from outside of the posts directories", post.FileName)
+		writeJSONError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	updated, err := blog.decodePost(w, r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Keep the original creation time unless a new one was given
+	if updated.Created.IsZero() {
+		updated.Created = post.Created
+	}
+	updated.Updated = time.Now()
+
+	// Overwrite the file and then reload so the changes go live
+	if err := writePostFile(post.FileName, updated, false); err != nil {
+		logger.Error("Cannot write post %s: %s", post.FileName, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, "cannot write post")
+		return
+	}
+	if err := blog.loadPosts(); err != nil {
+		logger.Error("Could not reload posts: %s", err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	updated.slug = blog.slugify(updated.Title)
+	updated.path = blog.postPath(updated, updated.SafeURL())
+	writeJSON(w, http.StatusOK, blog.postMeta(updated))
+}
+
+// Handles the requests to delete a post, e.g. DELETE /api/posts/{slug}
+func apiDeletePostHandler(w http.ResponseWriter, r *http.Request, blog *Blog, post *Post) {
+
+	// Never remove a file from outside of the posts directories
+	if !blog.inPostsDirs(post.FileName) {
+		logger.Error("Refusing to delete post %s from outside of the posts directories", post.FileName)
+		writeJSONError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	if err := os.Remove(post.FileName); err != nil {
+		logger.Error("Cannot delete post %s: %s", post.FileName, err.Error())
+		writeJSONError(w, http.StatusInternalServerError, "cannot delete post")
+		return
+	}
+	if err := blog.loadPosts(); err != nil {
+		logger.Error("Could not reload posts: %s", err.Error())
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
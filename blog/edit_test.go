@@ -0,0 +1,211 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Will create a blog with the admin credentials that are used by the edit requests
+func newEditBlog(t *testing.T, posts map[string]string) *Blog {
+	t.Helper()
+	return newTestBlog(t, posts, func(c *Configuration) {
+		c.AdminUser, c.AdminPassword = "admin", "secret"
+	})
+}
+
+// Will make the API request as the admin
+func adminRequest(blog *Blog, handler func(w http.ResponseWriter, r *http.Request, blog *Blog, template string),
+	method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.SetBasicAuth("admin", "secret")
+	w := httptest.NewRecorder()
+	handler(w, r, blog, "")
+	return w
+}
+
+func TestCreatePost(t *testing.T) {
+	blog := newEditBlog(t, nil)
+	w := adminRequest(blog, apiPostsHandler, "POST", "/api/posts", `{"Title": "New Post", "Body": "<p>Fresh</p>"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if w.Header().Get("Location") != "/posts/new-post" {
+		t.Errorf("expected the location of the post, got %s", w.Header().Get("Location"))
+	}
+	if _, err := os.Stat(filepath.Join(blog.configuration.Postsdir, "new-post.json")); err != nil {
+		t.Errorf("expected the post file to be written: %s", err)
+	}
+
+	// The post is live straight away
+	w = httptest.NewRecorder()
+	viewPostsHandler(w, httptest.NewRequest("GET", "/posts", nil), blog, "posts.html")
+	if !strings.Contains(w.Body.String(), "<h2>New Post</h2>") {
+		t.Errorf("expected the post to be listed, got %q", w.Body.String())
+	}
+
+	// The same title cannot be used twice
+	w = adminRequest(blog, apiPostsHandler, "POST", "/api/posts", `{"Title": "New Post", "Body": "<p>Again</p>"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status %d for a duplicate slug, got %d", http.StatusConflict, w.Code)
+	}
+	w = adminRequest(blog, apiPostsHandler, "POST", "/api/posts", `{"Body": "<p>Untitled</p>"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d without a title, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// Only the admin can create posts
+	w = httptest.NewRecorder()
+	apiPostsHandler(w, httptest.NewRequest("POST", "/api/posts", strings.NewReader(`{"Title": "Other"}`)), blog, "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without credentials, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestDeletePost(t *testing.T) {
+	blog := newEditBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	})
+	w := adminRequest(blog, apiPostHandler, "DELETE", "/api/posts/hello-world", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(blog.configuration.Postsdir, "hello.json")); !os.IsNotExist(err) {
+		t.Errorf("expected the post file to be removed, got %v", err)
+	}
+	if blog.snapshot().postMap["hello-world"] != nil {
+		t.Errorf("expected the post to be removed from the posts")
+	}
+
+	// The post no longer exists
+	w = adminRequest(blog, apiPostHandler, "DELETE", "/api/posts/hello-world", "")
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("expected a JSON %d, got %d %s", http.StatusNotFound, w.Code, w.Header().Get("Content-Type"))
+	}
+}
+
+func TestDeletePostTraversal(t *testing.T) {
+	blog := newEditBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	})
+	outside := filepath.Join(t.TempDir(), "outside.json")
+	writeFiles(t, filepath.Dir(outside), map[string]string{"outside.json": `{"Title": "Outside"}`})
+
+	// The slug is only ever used to find a loaded post
+	for _, path := range []string{"/api/posts/../outside", "/api/posts/..%2F..%2Foutside", "/api/posts/" + outside} {
+		w := adminRequest(blog, apiPostHandler, "DELETE", path, "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusNotFound, w.Code)
+		}
+	}
+
+	// And a post from outside of the posts directories is never removed
+	w := httptest.NewRecorder()
+	apiDeletePostHandler(w, httptest.NewRequest("DELETE", "/api/posts/outside", nil), blog, &Post{FileName: outside})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("expected the file outside of the posts directory to remain: %s", err)
+	}
+}
+
+func TestPostResourceMethods(t *testing.T) {
+	blog := newEditBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	})
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/api/posts/missing", http.StatusNotFound},
+		{"POST", "/api/posts/missing", http.StatusNotFound},
+		{"GET", "/api/posts/hello-world", http.StatusMethodNotAllowed},
+		{"GET", "/api/posts/hello-world/meta", http.StatusOK},
+		{"DELETE", "/api/posts/hello-world/meta", http.StatusMethodNotAllowed},
+		{"GET", "/api/posts/hello-world/raw", http.StatusOK},
+		{"PUT", "/api/posts/hello-world/raw", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		w := adminRequest(blog, apiPostHandler, test.method, test.path, "")
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected status %d, got %d", test.method, test.path, test.status, w.Code)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(blog.configuration.Postsdir, "hello.json")); err != nil {
+		t.Errorf("expected the post to remain: %s", err)
+	}
+}
+
+func TestUpdatePost(t *testing.T) {
+	blog := newEditBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>", "Created": "2013-06-01T00:00:00Z"}`,
+	})
+	w := adminRequest(blog, apiPostHandler, "PUT", "/api/posts/hello-world", `{"Title": "Hello World", "Body": "<p>A new body</p>"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	post := blog.snapshot().postMap["hello-world"]
+	if post == nil || post.Body != "<p>A new body</p>" {
+		t.Fatalf("expected the body to be replaced, got %+v", post)
+	}
+	if post.Created.Year() != 2013 || !post.IsUpdated() {
+		t.Errorf("expected the creation time to be kept and the post to be updated, got %s and %s", post.Created, post.Updated)
+	}
+
+	tests := []struct {
+		path, body string
+		status     int
+	}{
+		{"/api/posts/missing", `{"Title": "Missing"}`, http.StatusNotFound},
+		{"/api/posts/hello-world", `{"Title": "Hello World",`, http.StatusBadRequest},
+		{"/api/posts/hello-world", `{"Body": "<p>Untitled</p>"}`, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := adminRequest(blog, apiPostHandler, "PUT", test.path, test.body)
+		if w.Code != test.status {
+			t.Errorf("%s %s: expected status %d, got %d", test.path, test.body, test.status, w.Code)
+		}
+	}
+	if post := blog.snapshot().postMap["hello-world"]; post.Body != "<p>A new body</p>" {
+		t.Errorf("expected the invalid updates not to change the post, got %q", post.Body)
+	}
+}
+
+func TestCreatePostExtension(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.AdminUser, c.AdminPassword = "admin", "secret"
+		c.PostExtensions = []string{".post"}
+	})
+	w := adminRequest(blog, apiPostsHandler, "POST", "/api/posts", `{"Title": "New Post", "Body": "<p>Fresh</p>"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(blog.configuration.Postsdir, "new-post.post")); err != nil {
+		t.Errorf("expected the post file to use the configured extension: %s", err)
+	}
+	if blog.snapshot().postMap["new-post"] == nil {
+		t.Errorf("expected the post to be loaded")
+	}
+}
+
+func TestCreatePostAttachmentOutsidePostsDir(t *testing.T) {
+	blog := newEditBlog(t, nil)
+	for _, path := range []string{"../../etc/passwd", "/etc/passwd", ".."} {
+		w := adminRequest(blog, apiPostsHandler, "POST", "/api/posts",
+			`{"Title": "New Post", "Attachments": [{"Name": "passwd", "Path": "`+path+`"}]}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusBadRequest, w.Code)
+		}
+	}
+	if len(blog.snapshot().posts) != 0 {
+		t.Errorf("expected no posts to be created")
+	}
+}
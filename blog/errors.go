@@ -0,0 +1,51 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPostsDirNotFound is returned when one of the posts directories does not exist
+var ErrPostsDirNotFound = errors.New("blog: posts directory not found")
+
+// ErrPostNotFound is returned when there is no post with the requested slug
+var ErrPostNotFound = errors.New("blog: post not found")
+
+// ErrInvalidAttachment is returned when the path of an attachment is outside of the directory of its post
+var ErrInvalidAttachment = errors.New("blog: attachment outside of the post directory")
+
+// ParseError is returned when a post file cannot be read or parsed
+type ParseError struct {
+	File string // The path of the post file
+	Err  error  // The underlying error
+}
+
+// Error returns the description of the error
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("blog: cannot parse post %s: %s", e.File, e.Err.Error())
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// TemplateError is returned when a template cannot be parsed or executed
+type TemplateError struct {
+	Name string // The name of the template
+	Err  error  // The underlying error
+}
+
+// Error returns the description of the error
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("blog: template %s: %s", e.Name, e.Err.Error())
+}
+
+// Unwrap returns the underlying error
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,40 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadErrors(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json":  `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+		"broken.json": `{"Title": "Broken",`,
+	}, nil)
+	if len(blog.snapshot().posts) != 1 {
+		t.Errorf("expected the valid post to be loaded, got %d posts", len(blog.snapshot().posts))
+	}
+	errs := blog.LoadErrors()
+	if len(errs) != 1 {
+		t.Fatalf("expected a single error, got %v", errs)
+	}
+	var parseErr *ParseError
+	if !errors.As(errs[0], &parseErr) {
+		t.Fatalf("expected a ParseError, got %T", errs[0])
+	}
+	if expected := filepath.Join(blog.configuration.Postsdir, "broken.json"); parseErr.File != expected {
+		t.Errorf("expected the error for %s, got %s", expected, parseErr.File)
+	}
+}
+
+func TestSetupMissingPostsDir(t *testing.T) {
+	blog := New(&Configuration{Title: "Test", Postsdir: filepath.Join(t.TempDir(), "missing"),
+		Templatesdir: t.TempDir(), Assetsdir: t.TempDir()})
+	if _, err := blog.setup(); !errors.Is(err, ErrPostsDirNotFound) {
+		t.Errorf("expected ErrPostsDirNotFound, got %v", err)
+	}
+}
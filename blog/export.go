@@ -0,0 +1,153 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// bufferResponseWriter will capture a rendered response so that it can be written to disk
+type bufferResponseWriter struct {
+	bytes.Buffer
+	header http.Header
+	status int
+}
+
+// Header returns the header map for the response
+func (w *bufferResponseWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader records the status of the response
+func (w *bufferResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+// exportKey marks the requests that are made when exporting the blog
+type exportKey struct{}
+
+// Will return true if the request is rendering a page for the static export rather than a reader
+func isExport(r *http.Request) bool {
+	exporting, _ := r.Context().Value(exportKey{}).(bool)
+	return exporting
+}
+
+// ExportStatic will render the entire blog as static HTML files into the output directory
+// The posts and templates are loaded in the same way as Start so a server is not required
+func (blog *Blog) ExportStatic(outputDir string) error {
+	if err := blog.loadPosts(); err != nil {
+		return err
+	}
+	if err := blog.loadTemplates(); err != nil {
+		return err
+	}
+	postsDir := filepath.Join(outputDir, blog.configuration.PostsPath)
+	if err := os.MkdirAll(postsDir, 0755); err != nil {
+		return err
+	}
+
+	// Render each of the pages using the same handlers that serve them
+	pages := []struct {
+		file     string
+		path     string
+		template string
+		handler  func(http.ResponseWriter, *http.Request, *Blog, string)
+	}{
+		{"index.html", "/", "home.html", viewHomeHandler},
+		{blog.configuration.PostsPath + ".html", blog.postsRoute(), "posts.html", viewPostsHandler},
+		{"about.html", "/about", "about.html", viewPostsHandler},
+		{"notfound.html", "/notfound", "notfound.html", notFoundHandler},
+	}
+	for _, page := range pages {
+		if err := blog.exportPage(filepath.Join(outputDir, page.file), page.path, page.template, page.handler); err != nil {
+			return err
+		}
+	}
+	for path, file := range blog.configuration.Pages {
+		name := filepath.Join(outputDir, filepath.FromSlash(strings.Trim(path, "/"))+".html")
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := blog.exportPage(name, path, blog.pageTemplate(), pageHandler(file)); err != nil {
+			return err
+		}
+	}
+	posts := blog.snapshot().posts
+	for _, post := range posts {
+		file := filepath.Join(outputDir, filepath.FromSlash(post.URL())+".html")
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := blog.exportPage(file, blog.postPath(post, post.SafeTitle()), "post.html", viewPostHandler); err != nil {
+			return err
+		}
+	}
+
+	// Finally copy across all of the assets
+	logger.Info("Exported %d posts to %s", len(posts), outputDir)
+	return copyDir(blog.configuration.Assetsdir, filepath.Join(outputDir, filepath.FromSlash(blog.configuration.AssetPrefix)))
+}
+
+// Will render the page for the path using the handler and write it to the file
+func (blog *Blog) exportPage(file, path, template string, handler func(http.ResponseWriter, *http.Request, *Blog, string)) error {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		return err
+	}
+	r.URL.Path = path
+	r = r.WithContext(context.WithValue(r.Context(), exportKey{}, true))
+
+	// Render the page into the buffer
+	w := &bufferResponseWriter{header: make(http.Header), status: http.StatusOK}
+	handler(w, r, blog, template)
+	if w.status != http.StatusOK && w.status != http.StatusNotFound {
+		return fmt.Errorf("cannot export %s: received status %d", path, w.status)
+	}
+	return ioutil.WriteFile(file, w.Bytes(), 0644)
+}
+
+// Will recursively copy the contents of the source directory into the destination
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		return copyFile(p, target)
+	})
+}
+
+// Will copy the file at the source path to the destination path
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
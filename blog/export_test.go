@@ -0,0 +1,45 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportStatic(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>Hello</p>", "Created": "2013-06-01T00:00:00Z"}`,
+		"other.json": `{"Title": "Other Post", "Body": "<p>Other</p>", "Created": "2013-07-01T00:00:00Z"}`,
+	}, func(c *Configuration) {
+		c.HomeRedirectToLatest = true
+	})
+	outputDir := t.TempDir()
+	if err := blog.ExportStatic(outputDir); err != nil {
+		t.Fatal(err)
+	}
+	for file, expected := range map[string]string{
+		"index.html":             "<h2>Other Post</h2>",
+		"posts/hello-world.html": "<p>Hello</p>",
+		"posts/other-post.html":  "<p>Other</p>",
+		"posts.html":             "<h2>Hello World</h2>",
+	} {
+		b, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(file)))
+		if err != nil {
+			t.Errorf("expected %s to be exported: %s", file, err)
+			continue
+		}
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("expected %s to contain %q, got %q", file, expected, b)
+		}
+	}
+
+	// Exporting is not a reader viewing the posts
+	if views := blog.configuration.Views.Count("hello-world"); views != 0 {
+		t.Errorf("expected the export not to count any views, got %d", views)
+	}
+}
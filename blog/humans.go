@@ -0,0 +1,49 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// Handles the requests for the humans.txt crediting the people behind the site
+func humansHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	// Serve the configured file if there is one (it is read on every request so it can be edited)
+	if blog.configuration.HumansTxt != "" {
+		b, err := ioutil.ReadFile(blog.configuration.HumansTxt)
+		if err != nil {
+			logger.Error("Cannot read humans.txt %s: %s", blog.configuration.HumansTxt, err.Error())
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Write(b)
+		return
+	}
+	w.Write(blog.humansTxt())
+}
+
+// Will generate the default humans.txt from the configuration
+func (blog *Blog) humansTxt() []byte {
+	author := blog.configuration.CopyrightOwner
+	if author == "" {
+		author = blog.configuration.SiteName
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "/* TEAM */\nAuthor: %s\n", author)
+	if blog.configuration.SiteURL != "" {
+		fmt.Fprintf(&b, "Site: %s\n", blog.configuration.SiteURL)
+	}
+	fmt.Fprintf(&b, "\n/* SITE */\n")
+	if updated := blog.snapshot().updated; len(updated) > 0 {
+		fmt.Fprintf(&b, "Last update: %s\n", updated[0].Updated.Format("2006/01/02"))
+	}
+	fmt.Fprintf(&b, "Language: %s\nSoftware: simplegoblog %s\n", blog.configuration.Locale, Version)
+	return b.Bytes()
+}
@@ -0,0 +1,51 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestHumansHandler(t *testing.T) {
+	version := Version
+	defer func() { Version = version }()
+	Version = "1.2.3"
+
+	// The default is generated from the configuration
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Created": "2013-06-01T00:00:00Z", "Updated": "2013-06-02T00:00:00Z"}`,
+	}, func(c *Configuration) {
+		c.CopyrightOwner, c.SiteURL = "Landon Wainwright", "http://www.example.com"
+	})
+	w := get(blog, humansHandler, "", "/humans.txt")
+	expected := "/* TEAM */\nAuthor: Landon Wainwright\nSite: http://www.example.com\n\n/* SITE */\n" +
+		"Last update: 2013/06/02\nLanguage: en_US\nSoftware: simplegoblog 1.2.3\n"
+	if w.Body.String() != expected {
+		t.Errorf("expected the generated humans.txt %q, got %q", expected, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("expected plain text, got %s", contentType)
+	}
+
+	// The configured file is served instead
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"humans.txt": "/* TEAM */\nAuthor: Someone Else\n"})
+	blog = newTestBlog(t, nil, func(c *Configuration) {
+		c.HumansTxt = filepath.Join(dir, "humans.txt")
+	})
+	if body := get(blog, humansHandler, "", "/humans.txt").Body.String(); body != "/* TEAM */\nAuthor: Someone Else\n" {
+		t.Errorf("expected the configured file, got %q", body)
+	}
+
+	// A missing file is an error rather than the default
+	blog = newTestBlog(t, nil, func(c *Configuration) {
+		c.HumansTxt = filepath.Join(dir, "missing.txt")
+	})
+	if w := get(blog, humansHandler, "", "/humans.txt"); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Will parse the trusted proxy addresses, each may be a single IP or a CIDR range
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			logger.Error("Cannot parse trusted proxy %s: %s", proxy, err.Error())
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// Will return true if the IP address belongs to one of the trusted proxies
+func (blog *Blog) isTrustedProxy(ip net.IP) bool {
+	for _, network := range blog.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP will return the IP address of the client that made the request
+// The forwarding headers are only used when the request came from a trusted proxy, in which
+// case the X-Forwarded-For addresses are walked from the right until an untrusted one is found
+func (blog *Blog) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !blog.isTrustedProxy(ip) {
+		return host
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addresses := strings.Split(forwarded, ",")
+		for i := len(addresses) - 1; i >= 0; i-- {
+			address := net.ParseIP(strings.TrimSpace(addresses[i]))
+			if address == nil {
+				break
+			}
+			host = address.String()
+			if !blog.isTrustedProxy(address) {
+				break
+			}
+		}
+		return host
+	}
+	if real := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); real != nil {
+		return real.String()
+	}
+	return host
+}
+
+// requestScheme will return the scheme that the client used to make the request
+// The X-Forwarded-Proto header is only used when the request came from a trusted proxy
+func (blog *Blog) requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && blog.isTrustedProxy(ip) {
+		if proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto == "https" || proto == "http" {
+			return proto
+		}
+	}
+	return "http"
+}
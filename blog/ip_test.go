@@ -0,0 +1,43 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.TrustedProxies = []string{"10.0.0.1", "192.168.0.0/16"}
+	})
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		expected   string
+	}{
+		{"trusted proxy forwarded for", "10.0.0.1:1234", "203.0.113.7", "", "203.0.113.7"},
+		{"trusted proxy chain", "10.0.0.1:1234", "203.0.113.7, 198.51.100.2, 192.168.1.1", "", "198.51.100.2"},
+		{"trusted proxy real ip", "192.168.1.1:1234", "", "203.0.113.7", "203.0.113.7"},
+		{"trusted proxy without headers", "10.0.0.1:1234", "", "", "10.0.0.1"},
+		{"untrusted forwarded for", "203.0.113.9:1234", "198.51.100.2", "", "203.0.113.9"},
+		{"untrusted real ip", "203.0.113.9:1234", "", "198.51.100.2", "203.0.113.9"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+		if ip := blog.clientIP(r); ip != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, ip)
+		}
+	}
+}
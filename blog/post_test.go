@@ -0,0 +1,132 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsUpdated(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"edited.json":    `{"Title": "Edited", "Created": "2013-06-01T00:00:00Z", "Updated": "2013-06-05T00:00:00Z"}`,
+		"corrected.json": `{"Title": "Corrected", "Created": "2013-06-01T00:00:00Z", "Updated": "2013-06-01T00:30:00Z"}`,
+		"copied.json":    `{"Title": "Copied", "Created": "2013-06-01T00:00:00Z"}`,
+	}, nil)
+	tests := []struct {
+		slug    string
+		updated bool
+	}{
+		{"edited", true},
+		{"corrected", false},
+
+		// The file was written long after the post was created but the post was never edited
+		{"copied", false},
+	}
+	for _, test := range tests {
+		post := blog.snapshot().postMap[test.slug]
+		if post == nil {
+			t.Fatalf("expected the post %s to be loaded", test.slug)
+		}
+		if post.IsUpdated() != test.updated {
+			t.Errorf("%s: expected IsUpdated to be %t", test.slug, test.updated)
+		}
+	}
+}
+
+func TestListingHTML(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"more.json":      `{"Title": "More", "Summary": "The summary", "Body": "<p>The intro</p><!--more--><p>The rest</p>"}`,
+		"summary.json":   `{"Title": "Summary", "Summary": "The summary", "Body": "<p>First</p><p>Second</p>"}`,
+		"paragraph.json": `{"Title": "Paragraph", "Body": "<p>First</p><p>Second</p>"}`,
+	}, nil)
+	tests := map[string]string{
+		"more":      "<p>The intro</p>",
+		"summary":   "The summary",
+		"paragraph": "<p>First</p>",
+	}
+	for slug, expected := range tests {
+		if listing := string(blog.snapshot().postMap[slug].ListingHTML()); listing != expected {
+			t.Errorf("%s: expected the listing %q, got %q", slug, expected, listing)
+		}
+	}
+}
+
+func TestUpdatedDefaultsToModTime(t *testing.T) {
+	modTime := time.Date(2014, 3, 4, 5, 6, 7, 0, time.UTC)
+	blog := newTestBlog(t, map[string]string{
+		"copied.json": `{"Title": "Copied", "Created": "2013-06-01T00:00:00Z"}`,
+		"edited.json": `{"Title": "Edited", "Created": "2013-06-01T00:00:00Z", "Updated": "2013-06-05T00:00:00Z"}`,
+	}, func(c *Configuration) {
+		for _, name := range []string{"copied.json", "edited.json"} {
+			if err := os.Chtimes(filepath.Join(c.Postsdir, name), modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if updated := blog.snapshot().postMap["copied"].Updated; !updated.Equal(modTime) {
+		t.Errorf("expected the updated time to be the file modification time %s, got %s", modTime, updated)
+	}
+	if updated := blog.snapshot().postMap["edited"].Updated; !updated.Equal(time.Date(2013, 6, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the updated time of the post to be kept, got %s", updated)
+	}
+}
+
+func TestPermalink(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(1), nil)
+	post := blog.snapshot().postMap["post-1"]
+	for _, baseURL := range []string{"http://www.example.com", "http://www.example.com/"} {
+		if permalink := post.Permalink(baseURL); permalink != "http://www.example.com/posts/post-1" {
+			t.Errorf("%s: expected the absolute URL of the post, got %s", baseURL, permalink)
+		}
+	}
+}
+
+func TestCheckDates(t *testing.T) {
+	now := time.Date(2013, 6, 1, 12, 0, 0, 0, time.UTC)
+	created, future := now.Add(-time.Hour), now.Add(48*time.Hour)
+	for _, clamp := range []bool{false, true} {
+		logs := recordLogs(t)
+		blog := newTestBlog(t, nil, func(c *Configuration) {
+			c.ClampFutureDates = clamp
+		})
+		post := &Post{FileName: "future.json", Created: created, Updated: future}
+		blog.checkDates(post, now)
+		if warnings := logs.find("WARN", "future.json", "updated date in the future"); len(warnings) != 1 {
+			t.Errorf("clamp %t: expected a warning for the updated date, got %v", clamp, logs.find("WARN"))
+		}
+		if warnings := logs.find("WARN", "future.json", "created date"); len(warnings) != 0 {
+			t.Errorf("clamp %t: expected no warning for the created date, got %v", clamp, warnings)
+		}
+		expected := future
+		if clamp {
+			expected = now
+		}
+		if !post.Updated.Equal(expected) || !post.Created.Equal(created) {
+			t.Errorf("clamp %t: expected the updated date %s, got %s", clamp, expected, post.Updated)
+		}
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	modTime := time.Date(2014, 3, 4, 5, 6, 7, 0, time.UTC)
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>Body</p>", "Created": "2013-06-01T00:00:00Z"}`,
+	}, func(c *Configuration) {
+		if err := os.Chtimes(filepath.Join(c.Postsdir, "hello.json"), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if lastModified := blog.snapshot().postMap["hello-world"].LastModified(); !lastModified.Equal(modTime) {
+		t.Errorf("expected the file modification time %s, got %s", modTime, lastModified)
+	}
+	w := get(blog, viewPostHandler, "post.html", "/posts/hello-world")
+	if header := w.Header().Get("Last-Modified"); header != modTime.Format(http.TimeFormat) {
+		t.Errorf("expected the Last-Modified header %s, got %s", modTime.Format(http.TimeFormat), header)
+	}
+}
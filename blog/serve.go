@@ -5,8 +5,24 @@
 package blog
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/landonia/tollbooth"
 	"github.com/landonia/tollbooth/config"
@@ -14,10 +30,62 @@ import (
 
 // PageContent data that is passed to all templates
 type PageContent struct {
-	Title       string
-	Description string
-	Posts       []*Post
-	Post        *Post
+	Title         string
+	Description   string
+	Image         string
+	Message       string // The message displayed on the page, e.g. on the not found page
+	SiteName      string
+	Locale        string
+	Posts         []*Post
+	Updated       []*Post // The most recently updated posts
+	Post          *Post
+	HasMorePosts  bool   // True when there are more posts than those listed, e.g. on the home page
+	Page          int    // The current page of a paginated listing (starting at 1)
+	PageCount     int    // The total number of pages within a paginated listing
+	NoIndex       bool   // True when the page should not be indexed by search engines
+	PostsURL      string // The path of the page listing all of the posts
+	SiteURL       string // The absolute base URL of the site, e.g. for {{.Post.Permalink .SiteURL}}
+	ReadMoreText  string // The text of the link from a listed post to the full post
+	Footer        Footer
+	Site          map[string]interface{} // The configured global data
+	Views         int                    // The number of times the post has been viewed
+	ArchiveAfter  time.Duration          // The age after which a post is archived
+	ExcerptLength int                    // The maximum number of characters of each listed post excerpt (not truncated if zero)
+}
+
+// Archived will return true if the post is older than the configured ArchiveAfter, e.g. {{if $.Archived .Post}}
+func (content PageContent) Archived(post *Post) bool {
+	return post.IsArchived(content.ArchiveAfter)
+}
+
+// Excerpt will return the listing of the post truncated to the excerpt length, e.g. {{$.Excerpt .}}
+// A truncated excerpt is plain text as the HTML tags cannot be cut safely
+func (content PageContent) Excerpt(post *Post) template.HTML {
+	if content.ExcerptLength <= 0 {
+		return post.ListingHTML()
+	}
+	text := []rune(strings.Join(strings.Fields(stripTags(post.listing)), " "))
+	if len(text) <= content.ExcerptLength {
+		return post.ListingHTML()
+	}
+
+	// Cut at the last word boundary within the length where possible
+	cut := content.ExcerptLength
+	for i := cut; i > 0; i-- {
+		if text[i] == ' ' {
+			cut = i
+			break
+		}
+	}
+	return template.HTML(template.HTMLEscapeString(strings.TrimSpace(string(text[:cut]))) + "&hellip;")
+}
+
+// Footer contains the site wide data that is displayed in the footer
+type Footer struct {
+	CopyrightOwner string
+	CopyrightYear  int
+	Version        string
+	Commit         string
 }
 
 // AddCustomHandler to the existing handlers
@@ -30,44 +98,335 @@ func AddCustomHandler(path string, handler func(http.ResponseWriter, *http.Reque
 
 // Start the blog on the chosen address
 func (blog *Blog) Start(addr string) error {
+	handler, err := blog.setup()
+	if err != nil {
+		return err
+	}
+
+	// Start the server
+	logger.Info("Starting server using address: %s", addr)
+	return http.ListenAndServe(addr, handler)
+}
+
+// StartTLS will start the blog on the chosen address serving HTTPS using the certificate and key files
+// The TLS configuration defaults to TLS 1.2 or above with modern ciphers, and HTTP/2 is enabled
+func (blog *Blog) StartTLS(addr, certFile, keyFile string) error {
+	handler, err := blog.setup()
+	if err != nil {
+		return err
+	}
+
+	// Start the server
+	server := &http.Server{Addr: addr, Handler: handler, TLSConfig: blog.tlsConfig()}
+	logger.Info("Starting TLS server using address: %s", addr)
+	return server.ListenAndServeTLS(certFile, keyFile)
+}
+
+// Will return the TLS configuration of the server (a copy of the configured TLS configuration if one was set)
+func (blog *Blog) tlsConfig() *tls.Config {
+	if blog.configuration.TLSConfig != nil {
+		return blog.configuration.TLSConfig.Clone()
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		},
+	}
+}
+
+// Will load the posts and templates and register all of the handlers
+// The returned handler wraps the registered handlers with the site wide middleware
+func (blog *Blog) setup() (http.Handler, error) {
 
 	// Read in all the post files
 	err := blog.loadPosts()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// The posts would not be reloaded when they change
+	if blog.watchErr != nil {
+		return nil, blog.watchErr
 	}
 
 	// Use tollbooth as a throttle limiter based on standard request IP. The limit will be for a second
 	var throttleLimit = tollbooth.NewLimiter(blog.configuration.RequestHandlerLimit.Max, blog.configuration.RequestHandlerLimit.TTL)
 
 	// Setup the templates
-	//this.templates = spitz.New(templatesdir, this.developmentMode)
-	blog.templates = template.Must(template.ParseFiles(blog.getTemplatePath("header.html"),
-		blog.getTemplatePath("footer.html"), blog.getTemplatePath("home.html"),
-		blog.getTemplatePath("post.html"), blog.getTemplatePath("posts.html"),
-		blog.getTemplatePath("notfound.html"), blog.getTemplatePath("about.html")))
-
-	// Setup the handlers
-	http.Handle("/", generateHandler(blog, "home.html", viewHomeHandler, throttleLimit))
-	http.Handle("/posts", generateHandler(blog, "posts.html", viewPostsHandler, throttleLimit))
-	http.Handle("/posts/", generateHandler(blog, "post.html", viewPostHandler, throttleLimit))
-	http.Handle("/about", generateHandler(blog, "about.html", viewPostsHandler, throttleLimit))
-	http.Handle("/notfound", generateHandler(blog, "notfound.html", notFoundHandler, throttleLimit))
+	err = blog.loadTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	// The static pages cannot replace any of the built-in routes
+	if err := blog.checkPages(); err != nil {
+		return nil, err
+	}
+
+	// The special files at the root of the site are registered using their exact paths. The ServeMux
+	// always prefers the longest matching pattern, so these are matched before the catch-all home
+	// route regardless of the order in which they are registered
+	blog.handle("/humans.txt", generateHandler(blog, "", humansHandler, throttleLimit))
+
+	// Setup the handlers (the single post route is still rate limited but has no request timeout as it
+	// also serves the attachment downloads)
+	blog.handle(blog.postsRoute(), blog.timeoutHandler(generateHandler(blog, "posts.html", viewPostsHandler, throttleLimit)))
+	blog.handle(blog.postsRoute()+"/", generateHandler(blog, "post.html", viewPostHandler, throttleLimit))
+	blog.handle("/about", blog.timeoutHandler(generateHandler(blog, "about.html", viewPostsHandler, throttleLimit)))
+	blog.handle("/notfound", generateHandler(blog, "notfound.html", notFoundHandler, throttleLimit))
+	blog.handle("/latest", generateHandler(blog, "notfound.html", latestHandler, throttleLimit))
+	blog.handle("/subscribe", generateHandler(blog, "subscribe.html", subscribeHandler,
+		tollbooth.NewLimiter(blog.configuration.SubscribeLimit.Max, blog.configuration.SubscribeLimit.TTL)))
+	blog.handle("/preview/", generateHandler(blog, "post.html", previewHandler, throttleLimit))
+	blog.handle("/admin/reload", generateHandler(blog, "", reloadHandler, throttleLimit))
+	blog.handle(apiPrefix, generateHandler(blog, "", apiNotFoundHandler, throttleLimit))
+	blog.handle(apiPrefix+"posts", generateHandler(blog, "", apiPostsHandler, throttleLimit))
+	blog.handle(apiPrefix+"posts/", generateHandler(blog, "", apiPostHandler, throttleLimit))
+	blog.handle(apiPrefix+"posts/popular", generateHandler(blog, "", apiPopularHandler, throttleLimit))
+	blog.handle(apiPrefix+"stats", generateHandler(blog, "", apiStatsHandler, throttleLimit))
+
+	// Add the static pages
+	for path, file := range blog.configuration.Pages {
+		blog.handle(path, blog.timeoutHandler(generateHandler(blog, blog.pageTemplate(), pageHandler(file), throttleLimit)))
+	}
 
 	// Add the file server for the asset directory
-	http.Handle("/assets/", tollbooth.LimitHandler(throttleLimit,
-		http.StripPrefix("/assets/", http.FileServer(http.Dir(blog.configuration.Assetsdir)))))
+	// The file server handles range requests so the wrapping handlers must pass partial responses through untouched
+	manifest, err := blog.assetManifest()
+	if err != nil {
+		return nil, err
+	}
+	blog.handle(blog.configuration.AssetPrefix+assetManifest, blog.limitHandler(throttleLimit, manifestHandler(manifest)))
+	blog.handle(blog.configuration.AssetPrefix, blog.limitHandler(throttleLimit, blog.assetHandler()))
 
-	// Start the server
-	logger.Info("Starting server using address: %s", addr)
-	return http.ListenAndServe(addr, nil)
+	// The home page matches every path that no other route has been registered for
+	blog.handle("/", blog.timeoutHandler(generateHandler(blog, "home.html", viewHomeHandler, throttleLimit)))
+	return blog.wrapHandler(http.DefaultServeMux), nil
+}
+
+// The templates that a theme does not have to provide
+var optionalTemplates = []string{"subscribe.html", "amp.html", "page.html", "ratelimited.html"}
+
+// The directory within the theme holding the alternate layouts that the posts can be rendered with
+const layoutsDir = "layouts"
+
+// The suffix of the path of the AMP variant of a post
+const ampSuffix = "/amp"
+
+// Will parse all of the templates used by the blog
+func (blog *Blog) loadTemplates() error {
+	//this.templates = spitz.New(templatesdir, this.developmentMode)
+	templates := template.New("blog").Funcs(blog.templateFuncs())
+	for _, name := range []string{"header.html", "footer.html", "home.html", "post.html", "posts.html", "notfound.html", "about.html"} {
+		if _, err := templates.ParseFiles(blog.getTemplatePath(name)); err != nil {
+			return &TemplateError{Name: name, Err: err}
+		}
+	}
+
+	// The optional templates are only parsed if the theme provides them
+	for _, name := range optionalTemplates {
+		if _, err := os.Stat(blog.getTemplatePath(name)); err != nil {
+			continue
+		}
+		if _, err := templates.ParseFiles(blog.getTemplatePath(name)); err != nil {
+			return &TemplateError{Name: name, Err: err}
+		}
+	}
+
+	// The alternate layouts that the posts can choose are kept in their own directory so the other
+	// files of the theme are never parsed. Each is parsed into its own copy of the templates so it
+	// cannot replace the templates shared by the rest of the pages, e.g. the header
+	files, err := filepath.Glob(filepath.Join(blog.configuration.Templatesdir, layoutsDir, "*.html"))
+	if err != nil {
+		return err
+	}
+	layouts := make(map[string]*template.Template, len(files))
+	for _, file := range files {
+		name := path.Join(layoutsDir, filepath.Base(file))
+		layout, err := templates.Clone()
+		if err != nil {
+			return err
+		}
+		if _, err := layout.ParseFiles(file); err != nil {
+			return &TemplateError{Name: name, Err: err}
+		}
+		layouts[name] = layout
+	}
+	blog.templates, blog.layouts = templates, layouts
+	return nil
+}
+
+// Will return the helper functions that are available within the templates
+func (blog *Blog) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"localtime": blog.localTime,
+		"date":      blog.formatDate,
+		"t":         blog.message,
+		"asset":     blog.assetPath,
+	}
+}
+
+// Routes will return the sorted paths of all the routes that the blog has registered
+// The routes are registered when the blog is started
+func (blog *Blog) Routes() []string {
+	routes := make([]string, len(blog.routes))
+	copy(routes, blog.routes)
+	sort.Strings(routes)
+	return routes
+}
+
+// Will register the handler for the path wrapping it with the configured instrumentation
+func (blog *Blog) handle(path string, handler http.Handler) {
+	blog.routes = append(blog.routes, path)
+	http.Handle(path, blog.traceHandler(path, handler))
+}
+
+// Will wrap the handler with the middleware that applies across all of the routes
+func (blog *Blog) wrapHandler(handler http.Handler) http.Handler {
+	handler = blog.apiKeyHandler(handler)
+	handler = blog.corsHandler(handler)
+	handler = blog.adminAuthHandler(handler)
+	handler = blog.hstsHandler(handler)
+	handler = blog.canonicalHostHandler(handler)
+	return blog.concurrencyHandler(handler)
+}
+
+// Will return an error if any of the static pages cannot be registered as it is not a path
+// or it is already used by one of the built-in routes registered by setup
+func (blog *Blog) checkPages() error {
+	builtin := []string{"/", "/humans.txt", blog.postsRoute(), blog.postsRoute() + "/", "/about", "/notfound", "/latest",
+		"/subscribe", "/preview/", "/admin/reload", apiPrefix, apiPrefix + "posts", apiPrefix + "posts/",
+		apiPrefix + "posts/popular", apiPrefix + "stats", blog.configuration.AssetPrefix,
+		blog.configuration.AssetPrefix + assetManifest}
+	for path := range blog.configuration.Pages {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("blog: the page path %s must start with /", path)
+		}
+		for _, route := range builtin {
+			if path == route {
+				return fmt.Errorf("blog: the page path %s is already used by a built-in route", path)
+			}
+		}
+	}
+	return nil
+}
+
+// Will return the handler serving the files from the asset directory
+func (blog *Blog) assetHandler() http.Handler {
+	return cacheVersionedHandler(blog.themedNotFoundHandler(
+		http.StripPrefix(blog.configuration.AssetPrefix, http.FileServer(http.Dir(blog.configuration.Assetsdir)))))
+}
+
+// Will permanently redirect the requests for any host other than the canonical host, e.g. www.example.com
+func (blog *Blog) canonicalHostHandler(handler http.Handler) http.Handler {
+	if blog.configuration.CanonicalHost == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Host, blog.configuration.CanonicalHost) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		// Keep the scheme, path and query of the original request (the scheme is taken from the
+		// trusted proxy when the TLS connection ends at the proxy)
+		target := blog.requestScheme(r) + "://" + blog.configuration.CanonicalHost + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
+
+// Will add the Strict-Transport-Security header to the requests made over HTTPS
+func (blog *Blog) hstsHandler(handler http.Handler) http.Handler {
+	if blog.configuration.HSTSMaxAge <= 0 {
+		return handler
+	}
+	value := fmt.Sprintf("max-age=%d", blog.configuration.HSTSMaxAge)
+	if blog.configuration.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if blog.configuration.HSTSPreload {
+		value += "; preload"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// The header must not be sent over plain HTTP
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Will return a service unavailable response when the maximum number of requests are already being handled
+func (blog *Blog) concurrencyHandler(handler http.Handler) http.Handler {
+	if blog.configuration.MaxConcurrentRequests <= 0 {
+		return handler
+	}
+	semaphore := make(chan struct{}, blog.configuration.MaxConcurrentRequests)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case semaphore <- struct{}{}:
+			defer func() { <-semaphore }()
+			handler.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// Will limit the time the handler has to respond to the configured request timeout
+// The themed not found page is used for the body of the service unavailable response
+func (blog *Blog) timeoutHandler(handler http.Handler) http.Handler {
+	if blog.configuration.RequestTimeout <= 0 {
+		return handler
+	}
+	var b bytes.Buffer
+	if err := blog.executeTemplate(&b, "notfound.html", PageContent{Title: blog.message("unavailable.title")}); err != nil {
+		logger.Error("Cannot render the timeout page: %s", err.Error())
+		b.Reset()
+		b.WriteString(http.StatusText(http.StatusServiceUnavailable))
+	}
+	return http.TimeoutHandler(handler, blog.configuration.RequestTimeout, b.String())
 }
 
 // Will generate a handler passing the current blog handler
 func generateHandler(blog *Blog, template string, handler func(http.ResponseWriter, *http.Request, *Blog, string), throttleLimit *config.Limiter) http.Handler {
 
 	// Just call the underlying function using the throttle middleware
-	return tollbooth.LimitFuncHandler(throttleLimit, func(w http.ResponseWriter, r *http.Request) { handler(w, r, blog, template) })
+	return blog.limitHandler(throttleLimit, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handler(w, r, blog, template) }))
+}
+
+// Will throttle the requests to the handler using the limiter, rendering the rate limited response when exceeded
+func (blog *Blog) limitHandler(limiter *config.Limiter, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if httpError := tollbooth.LimitByRequest(limiter, r); httpError != nil {
+			blog.rateLimited(w, r, httpError.StatusCode)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Will respond to a throttled request using JSON for the API routes, otherwise the theme
+// ratelimited template (if it has one) or the plain message are used
+func (blog *Blog) rateLimited(w http.ResponseWriter, r *http.Request, status int) {
+	message := blog.message("ratelimited.message")
+	if strings.HasPrefix(r.URL.Path, apiPrefix) {
+		writeJSONError(w, status, message)
+		return
+	}
+	if blog.templates.Lookup("ratelimited.html") == nil {
+		http.Error(w, message, status)
+		return
+	}
+	blog.renderTemplate(w, "ratelimited.html", status, PageContent{Title: blog.message("ratelimited.title"), Message: message, NoIndex: true})
 }
 
 // Handles all the requests to the home page
@@ -77,58 +436,428 @@ func viewHomeHandler(w http.ResponseWriter, r *http.Request, blog *Blog, templat
 	// Only serve the home page if the path is /
 	if r.URL.Path != "/" {
 
+		// A path that matches a post slug is redirected to the post (the other routes are matched before this one)
+		if blog.configuration.RedirectNakedSlugs {
+			if post := blog.snapshot().postMap[r.URL.Path[1:]]; post != nil {
+				http.Redirect(w, r, post.URL(), http.StatusMovedPermanently)
+				return
+			}
+		}
+
+		// A missing file at the root, e.g. /sitemap.xml, is not found rather than redirected
+		// so that crawlers receive the correct status
+		if path.Ext(r.URL.Path) != "" {
+			notFoundHandler(w, r, blog, "notfound.html")
+			return
+		}
+
 		// Redirect to the not found page
 		http.Redirect(w, r, "/notfound", http.StatusFound)
 		return
 	}
 
 	// We want to display the last n (cnfiguration) number of posts on the home page (if there are that many)
-	recentPosts := blog.posts[:len(blog.posts)]
-	if len(recentPosts) > blog.configuration.NoOfRecentPosts {
+	recentPosts := blog.snapshot().posts
+
+	// Or go straight to the newest post (except when exporting, as a static file cannot redirect)
+	if blog.configuration.HomeRedirectToLatest && len(recentPosts) > 0 && !isExport(r) {
+		http.Redirect(w, r, recentPosts[0].URL(), http.StatusFound)
+		return
+	}
+	hasMorePosts := len(recentPosts) > blog.configuration.NoOfRecentPosts
+	if hasMorePosts {
 		recentPosts = recentPosts[:blog.configuration.NoOfRecentPosts]
 	}
 
-	blog.RenderTemplate(w, template, PageContent{Title: blog.configuration.Title, Posts: recentPosts})
+	blog.RenderTemplate(w, template, PageContent{Title: blog.configuration.Title, Posts: recentPosts, HasMorePosts: hasMorePosts,
+		Description: blog.configuration.Description, Image: blog.absoluteURL(blog.configuration.DefaultImage),
+		ExcerptLength: blog.configuration.HomeExcerptLength})
+}
+
+// Handles the requests to /latest by redirecting to the newest post
+func latestHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+	posts := blog.snapshot().posts
+	if len(posts) == 0 {
+		notFoundHandler(w, r, blog, template)
+		return
+	}
+	http.Redirect(w, r, posts[0].URL(), http.StatusFound)
 }
 
 // Handles all the requests to the posts page
 func viewPostsHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+	posts := blog.snapshot().posts
+
+	// The post listing is split into pages when a page size has been configured
+	page, pageCount := 1, 1
+	if r.URL.Path == blog.postsRoute() && blog.configuration.PostsPerPage > 0 {
+		pageCount = (len(posts) + blog.configuration.PostsPerPage - 1) / blog.configuration.PostsPerPage
+		if pageCount < 1 {
+			pageCount = 1
+		}
+		if p := r.URL.Query().Get("page"); p != "" {
+			var err error
+			if page, err = strconv.Atoi(p); err != nil || page < 1 || page > pageCount {
+
+				// Redirect to the not found page
+				http.Redirect(w, r, "/notfound", http.StatusFound)
+				return
+			}
+		}
+		start := (page - 1) * blog.configuration.PostsPerPage
+		end := start + blog.configuration.PostsPerPage
+		if end > len(posts) {
+			end = len(posts)
+		}
+		posts = posts[start:end]
+		setPageLinks(w, r.URL.Path, page, pageCount)
+	}
 
 	// Just send all the posts
-	blog.RenderTemplate(w, template, PageContent{Title: blog.configuration.Title, Posts: blog.posts})
+	blog.RenderTemplate(w, template, PageContent{Title: blog.configuration.Title, Posts: posts,
+		Description: blog.configuration.Description, Image: blog.absoluteURL(blog.configuration.DefaultImage),
+		Page: page, PageCount: pageCount})
+}
+
+// Will add the RFC 5988 Link header describing the pages that surround the current page
+func setPageLinks(w http.ResponseWriter, path string, page, pageCount int) {
+	link := func(p int, rel string) string {
+		return fmt.Sprintf(`<%s?page=%d>; rel="%s"`, path, p, rel)
+	}
+	links := []string{link(1, "first")}
+	if page > 1 {
+		links = append(links, link(page-1, "prev"))
+	}
+	if page < pageCount {
+		links = append(links, link(page+1, "next"))
+	}
+	links = append(links, link(pageCount, "last"))
+	w.Header().Set("Link", strings.Join(links, ", "))
 }
 
 // handles all the requests for displaying a specific post
 func viewPostHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
 
-	// Extract the post name
-	postName := r.URL.Path[len("/posts/"):]
+	// Extract the post name (and the attachment if one is being requested)
+	postName := strings.TrimPrefix(r.URL.Path, blog.postsRoute()+"/")
+	if postName == r.URL.Path || strings.Trim(postName, "/") == "" {
+
+		// There is no post within the path so show the listing instead
+		http.Redirect(w, r, blog.postsRoute(), http.StatusMovedPermanently)
+		return
+	}
+	attachment := ""
+	if i := strings.Index(postName, attachmentsSegment); i >= 0 {
+		postName, attachment = postName[:i], postName[i+len(attachmentsSegment):]
+	}
+
+	// Remove the date from the path when the posts use the date based permalinks
+	datePath := ""
+	if blog.configuration.PermalinkStyle == PermalinkDateSlug {
+		parts := strings.SplitN(postName, "/", 3)
+		if len(parts) != 3 {
+
+			// Redirect to the not found page
+			http.Redirect(w, r, "/notfound", http.StatusFound)
+			return
+		}
+		datePath, postName = parts[0]+"/"+parts[1], parts[2]
+	}
+
+	// The AMP variant of the post is only available if the theme provides the template
+	amp := attachment == "" && strings.HasSuffix(postName, ampSuffix)
+	if amp {
+		postName = strings.TrimSuffix(postName, ampSuffix)
+		template = "amp.html"
+		if blog.templates.Lookup(template) == nil {
+			notFoundHandler(w, r, blog, "notfound.html")
+			return
+		}
+	}
+
+	// The plain text variant of the post (unless the slug itself has the suffix)
+	plain := attachment == "" && !amp && strings.HasSuffix(postName, textSuffix) && blog.snapshot().postMap[postName] == nil
+	if plain {
+		postName = strings.TrimSuffix(postName, textSuffix)
+	}
+
+	// Redirect a trailing slash to the canonical path of the post
+	if attachment == "" && !amp && strings.HasSuffix(postName, "/") {
+		if post := blog.snapshot().postMap[strings.TrimRight(postName, "/")]; post != nil {
+			http.Redirect(w, r, post.URL(), http.StatusMovedPermanently)
+			return
+		}
+	}
 
 	// Locate the post
-	post := blog.postMap[postName]
+	setSpanPost(r, postName)
+	post := blog.snapshot().postMap[postName]
 	if post == nil {
 
 		// Redirect to the not found page
 		http.Redirect(w, r, "/notfound", http.StatusFound)
 		return
 	}
-	blog.RenderTemplate(w, template, PageContent{Title: post.Title, Post: post})
+
+	// Redirect a date that does not match the post to its canonical path
+	if datePath != "" && datePath != post.Created.Format(permalinkDateLayout) {
+		http.Redirect(w, r, post.URL(), http.StatusMovedPermanently)
+		return
+	}
+	if attachment != "" {
+		attachmentHandler(w, r, blog, post, attachment)
+		return
+	}
+
+	// Ensure the body has been read if it was not loaded with the posts
+	post, err := blog.loadBody(post)
+	if err != nil {
+		logger.Error("Cannot load the body for post %s: %s", postName, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Last-Modified", post.LastModified().UTC().Format(http.TimeFormat))
+	if plain {
+		textPostHandler(w, post)
+		return
+	}
+	if r.Method != "HEAD" && !isExport(r) {
+		blog.configuration.Views.Increment(post.SafeTitle())
+	}
+	if !amp {
+		template = blog.postTemplate(post, template)
+	}
+	content := blog.postContent(post)
+	content.Views = blog.configuration.Views.Count(post.SafeTitle())
+	blog.RenderTemplate(w, template, content)
+}
+
+// Will return the page content used to render the post
+func (blog *Blog) postContent(post *Post) PageContent {
+	return PageContent{Title: post.Title, Description: post.Summary, Post: post, Image: blog.postImage(post), NoIndex: post.NoIndex}
+}
+
+// Will return the layout chosen by the post if the theme has it, otherwise the default template
+func (blog *Blog) postTemplate(post *Post, defaultTemplate string) string {
+	if post.Template == "" {
+		return defaultTemplate
+	}
+	name := path.Join(layoutsDir, post.Template)
+	if blog.layouts[name] == nil {
+		logger.Warn("Post %s uses the missing template %s", post.FileName, name)
+		return defaultTemplate
+	}
+	return name
+}
+
+// RenderPostToString will render the post with the slug using the post template and return the HTML
+// The posts and templates are loaded first if the blog has not been started
+func (blog *Blog) RenderPostToString(slug string) (string, error) {
+	if blog.templates == nil {
+		if err := blog.loadPosts(); err != nil {
+			return "", err
+		}
+		if err := blog.loadTemplates(); err != nil {
+			return "", err
+		}
+	}
+	post := blog.snapshot().postMap[slug]
+	if post == nil {
+		return "", ErrPostNotFound
+	}
+	post, err := blog.loadBody(post)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := blog.executeTemplate(&b, blog.postTemplate(post, "post.html"), blog.postContent(post)); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Handles the requests to privately preview a draft post using the preview token
+func previewHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+
+	// Extract the post name
+	postName := strings.TrimPrefix(r.URL.Path, "/preview/")
+
+	// The draft is only displayed when the token matches
+	setSpanPost(r, postName)
+	token := []byte(r.URL.Query().Get("token"))
+	post := blog.snapshot().drafts[postName]
+	if post == nil || blog.configuration.PreviewToken == "" ||
+		subtle.ConstantTimeCompare(token, []byte(blog.configuration.PreviewToken)) != 1 {
+		notFoundHandler(w, r, blog, "notfound.html")
+		return
+	}
+
+	// Ensure the body has been read if it was not loaded with the posts
+	post, err := blog.loadBody(post)
+	if err != nil {
+		logger.Error("Cannot load the body for post %s: %s", postName, err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	content := blog.postContent(post)
+	content.NoIndex = true
+	blog.RenderTemplate(w, template, content)
+}
+
+// Will return the template used for the static pages, the theme may provide a page
+// template otherwise the post template is used
+func (blog *Blog) pageTemplate() string {
+	if blog.templates.Lookup("page.html") == nil {
+		return "post.html"
+	}
+	return "page.html"
+}
+
+// Will return a handler that renders the static page from the content file
+// The file is read on every request so the page can be edited without a reload
+func pageHandler(file string) func(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+	return func(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+		page, err := readPost(file)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				logger.Error("Cannot read page %s: %s", file, err.Error())
+			}
+			notFoundHandler(w, r, blog, "notfound.html")
+			return
+		}
+		page.slug = blog.slugify(page.Title)
+		blog.RenderTemplate(w, template, blog.postContent(page))
+	}
 }
 
 // Will be called when the requested page cannot be located
 func notFoundHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
 
-	// Just send back the not found immediately
-	w.WriteHeader(http.StatusNotFound)
+	// Suggest the most recent posts to the reader
+	suggestions := blog.snapshot().posts
+	if len(suggestions) > blog.configuration.NoOfRecentPosts {
+		suggestions = suggestions[:blog.configuration.NoOfRecentPosts]
+	}
 
 	// Render the not found page
-	blog.RenderTemplate(w, template, PageContent{Title: "Page Not Found"})
+	blog.renderTemplate(w, template, http.StatusNotFound, PageContent{Title: blog.message("notfound.title"),
+		Message: blog.message("notfound.message"), Posts: suggestions})
+}
+
+// statusResponseWriter will record the status code written to the underlying writer
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader will record the status before passing it to the underlying writer
+func (w *statusResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// notFoundResponseWriter will suppress a not found response so that it can be replaced
+type notFoundResponseWriter struct {
+	http.ResponseWriter
+	notFound bool
+}
+
+// WriteHeader will hold back the not found status
+func (w *notFoundResponseWriter) WriteHeader(status int) {
+	if status == http.StatusNotFound {
+		w.notFound = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write will discard the body of a not found response
+func (w *notFoundResponseWriter) Write(b []byte) (int, error) {
+	if w.notFound {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Will render the themed not found page in place of any not found response from the handler
+func (blog *Blog) themedNotFoundHandler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nw := &notFoundResponseWriter{ResponseWriter: w}
+		handler.ServeHTTP(nw, r)
+		if nw.notFound {
+
+			// Remove the plain text (and any caching) headers set by the original response
+			w.Header().Del("Content-Type")
+			w.Header().Del("X-Content-Type-Options")
+			w.Header().Del("Cache-Control")
+			notFoundHandler(w, r, blog, "notfound.html")
+		}
+	})
 }
 
 // RenderTemplate will render the chosen template
 func (blog *Blog) RenderTemplate(w http.ResponseWriter, tmpl string, data PageContent) {
-	err := blog.templates.ExecuteTemplate(w, tmpl, data)
+	blog.renderTemplate(w, tmpl, http.StatusOK, data)
+}
+
+// Will render the chosen template using the status, the headers are all set before the status is written
+func (blog *Blog) renderTemplate(w http.ResponseWriter, tmpl string, status int, data PageContent) {
+
+	// Render into a buffer so that the length and the ETag of the page are known before it is
+	// written, which allows a HEAD request to receive the same headers without the body
+	var b bytes.Buffer
+	err := blog.executeTemplate(&b, tmpl, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page := b.Bytes()
+	if blog.minifier != nil {
+		if page, err = blog.minifier.Bytes("text/html", page); err != nil {
+			logger.Warn("Cannot minify template %s: %s", tmpl, err.Error())
+			page = b.Bytes()
+		}
+	}
+	hash := sha256.Sum256(page)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:8])+`"`)
+	w.WriteHeader(status)
+	w.Write(page)
+}
+
+// Will execute the template into the writer after adding the site wide data
+func (blog *Blog) executeTemplate(w io.Writer, tmpl string, data PageContent) error {
+	data.Footer = blog.footer()
+	data.PostsURL = blog.postsRoute()
+	data.SiteURL = blog.configuration.SiteURL
+	data.ReadMoreText = blog.configuration.ReadMoreText
+	data.SiteName = blog.configuration.SiteName
+	data.Locale = blog.configuration.Locale
+	data.Site = blog.configuration.GlobalData
+	data.ArchiveAfter = blog.configuration.ArchiveAfter
+	data.Updated = blog.RecentlyUpdated(blog.configuration.NoOfRecentPosts)
+	templates, name := blog.templates, tmpl
+	if layout := blog.layouts[tmpl]; layout != nil {
+		templates, name = layout, path.Base(tmpl)
+	}
+	if err := templates.ExecuteTemplate(w, name, data); err != nil {
+		return &TemplateError{Name: tmpl, Err: err}
+	}
+	return nil
+}
+
+// Will return the data displayed in the footer of every page
+func (blog *Blog) footer() Footer {
+	return Footer{CopyrightOwner: blog.configuration.CopyrightOwner, CopyrightYear: blog.configuration.CopyrightYear,
+		Version: Version, Commit: Commit}
+}
+
+// Will write the value to the response as JSON using the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Could not write JSON response: %s", err.Error())
 	}
 }
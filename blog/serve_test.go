@@ -0,0 +1,871 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/landonia/tollbooth"
+)
+
+func TestPreviewHandler(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"draft.json": `{"Title": "Draft Post", "Body": "<p>Work in progress</p>", "Draft": true}`,
+	}, func(c *Configuration) {
+		c.PreviewToken = "secret"
+	})
+
+	// The draft is not published
+	w := httptest.NewRecorder()
+	viewPostHandler(w, httptest.NewRequest("GET", "/posts/draft-post", nil), blog, "post.html")
+	if strings.Contains(w.Body.String(), "Work in progress") {
+		t.Errorf("expected the draft not to be published")
+	}
+
+	// But can be previewed with the token
+	w = httptest.NewRecorder()
+	previewHandler(w, httptest.NewRequest("GET", "/preview/draft-post?token=secret", nil), blog, "post.html")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<p>Work in progress</p>") {
+		t.Errorf("expected the draft to be rendered, got %d %q", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `<meta name="robots" content="noindex">`) {
+		t.Errorf("expected the preview not to be indexed, got %q", w.Body.String())
+	}
+
+	for _, path := range []string{"/preview/draft-post?token=wrong", "/preview/draft-post", "/preview/missing?token=secret"} {
+		w = httptest.NewRecorder()
+		previewHandler(w, httptest.NewRequest("GET", path, nil), blog, "post.html")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusNotFound, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "Work in progress") {
+			t.Errorf("%s: expected the draft not to be rendered", path)
+		}
+	}
+}
+
+func TestPageHandler(t *testing.T) {
+	blog := newTestBlog(t, nil, nil)
+	dir := blog.configuration.Postsdir
+	writeFiles(t, dir, map[string]string{
+		"contact.page": `{"Title": "Contact", "Body": "<p>Get in touch</p>"}`,
+		"privacy.page": `{"Title": "Privacy", "Body": "<p>No cookies</p>"}`,
+	})
+	for file, expected := range map[string]string{"contact.page": "<p>Get in touch</p>", "privacy.page": "<p>No cookies</p>"} {
+		w := httptest.NewRecorder()
+		pageHandler(filepath.Join(dir, file))(w, httptest.NewRequest("GET", "/"+file, nil), blog, blog.pageTemplate())
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("%s: expected the page to be rendered, got %d %q", file, w.Code, w.Body.String())
+		}
+	}
+
+	// A missing file is not found
+	w := httptest.NewRecorder()
+	pageHandler(filepath.Join(dir, "missing.page"))(w, httptest.NewRequest("GET", "/missing", nil), blog, blog.pageTemplate())
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestSetupPageRouteCollision(t *testing.T) {
+	for _, path := range []string{"/about", "/posts", "/api/stats", "/", "contact"} {
+		blog := newTestBlog(t, nil, func(c *Configuration) {
+			c.Pages = map[string]string{"/contact": "contact.page", path: "other.page"}
+		})
+		if _, err := blog.setup(); err == nil || !strings.Contains(err.Error(), path) {
+			t.Errorf("%s: expected the page to be rejected, got %v", path, err)
+		}
+	}
+}
+
+func TestCanonicalHostHandler(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.CanonicalHost = "example.com"
+		c.TrustedProxies = []string{"10.0.0.1"}
+	})
+	handler := blog.canonicalHostHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name     string
+		host     string
+		remote   string
+		proto    string
+		location string
+	}{
+		{"canonical host", "example.com", "192.0.2.1:1234", "", ""},
+		{"other host", "www.example.com", "192.0.2.1:1234", "", "http://example.com/posts/hello?page=2"},
+		{"trusted proxy over https", "www.example.com", "10.0.0.1:1234", "https", "https://example.com/posts/hello?page=2"},
+		{"untrusted proxy over https", "www.example.com", "192.0.2.1:1234", "https", "http://example.com/posts/hello?page=2"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/posts/hello?page=2", nil)
+		r.Host, r.RemoteAddr = test.host, test.remote
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if test.location == "" {
+			if w.Code != http.StatusOK {
+				t.Errorf("%s: expected the request to pass through, got %d", test.name, w.Code)
+			}
+			continue
+		}
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.location {
+			t.Errorf("%s: expected a redirect to %s, got %d %s", test.name, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	blog := newTestBlog(t, nil, nil)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = blog.tlsConfig()
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	client := server.Client()
+	transport := client.Transport.(*http.Transport)
+	if _, err := client.Get(server.URL); err != nil {
+		t.Fatalf("expected a modern client to connect: %s", err)
+	}
+
+	// The outdated protocol versions are rejected
+	for _, version := range []uint16{tls.VersionTLS10, tls.VersionTLS11} {
+		transport.CloseIdleConnections()
+		transport.TLSClientConfig.MinVersion, transport.TLSClientConfig.MaxVersion = version, version
+		if _, err := client.Get(server.URL); err == nil {
+			t.Errorf("expected TLS version %x to be rejected", version)
+		}
+	}
+}
+
+func TestPostLayout(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"landing.json": `{"Title": "Landing", "Body": "<p>Sign up</p>", "Template": "landing.html"}`,
+		"missing.json": `{"Title": "Missing", "Body": "<p>Missing layout</p>", "Template": "missing.html"}`,
+	}, func(c *Configuration) {
+		if err := os.Mkdir(filepath.Join(c.Templatesdir, layoutsDir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		writeFiles(t, filepath.Join(c.Templatesdir, layoutsDir), map[string]string{
+			"landing.html": `{{define "header"}}<title>Landing</title>{{end}}{{template "header" .}}<main class="landing">{{.Post.BodySafe}}</main>`,
+		})
+
+		// The other files of the theme are not parsed, e.g. the templates of a front end framework
+		writeFiles(t, c.Templatesdir, map[string]string{"app.html": `<div>{{ message }}</div>`})
+	})
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/posts/landing", `<title>Landing</title><main class="landing"><p>Sign up</p></main>`},
+		{"/posts/missing", `<title>Missing</title><h1>Missing</h1><p>Missing layout</p>`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		viewPostHandler(w, httptest.NewRequest("GET", test.path, nil), blog, "post.html")
+		if !strings.Contains(w.Body.String(), test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.path, test.expected, w.Body.String())
+		}
+	}
+
+	// The header defined by the layout is not used by the other pages
+	w := httptest.NewRecorder()
+	viewHomeHandler(w, httptest.NewRequest("GET", "/", nil), blog, "home.html")
+	if !strings.Contains(w.Body.String(), "<title>Test</title>") {
+		t.Errorf("expected the shared header, got %q", w.Body.String())
+	}
+}
+
+func TestHeadRequests(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	}, nil)
+	handlers := map[string]http.HandlerFunc{
+		"/": func(w http.ResponseWriter, r *http.Request) { viewHomeHandler(w, r, blog, "home.html") },
+		"/posts/hello-world": func(w http.ResponseWriter, r *http.Request) {
+			viewPostHandler(w, r, blog, "post.html")
+		},
+		"/notfound": func(w http.ResponseWriter, r *http.Request) { notFoundHandler(w, r, blog, "notfound.html") },
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers[r.URL.Path](w, r)
+	}))
+	defer server.Close()
+	for path := range handlers {
+		get, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		get.Body.Close()
+		head, err := http.Head(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(head.Body)
+		head.Body.Close()
+		if len(body) != 0 {
+			t.Errorf("%s: expected an empty body, got %q", path, body)
+		}
+		if head.StatusCode != get.StatusCode {
+			t.Errorf("%s: expected status %d, got %d", path, get.StatusCode, head.StatusCode)
+		}
+		if head.Header.Get("ETag") == "" || head.Header.Get("ETag") != get.Header.Get("ETag") {
+			t.Errorf("%s: expected the ETag %q, got %q", path, get.Header.Get("ETag"), head.Header.Get("ETag"))
+		}
+		if head.ContentLength <= 0 || head.ContentLength != get.ContentLength {
+			t.Errorf("%s: expected the length %d, got %d", path, get.ContentLength, head.ContentLength)
+		}
+	}
+}
+
+func TestAMPPost(t *testing.T) {
+	posts := map[string]string{"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`}
+	blog := newTestBlog(t, posts, func(c *Configuration) {
+		writeFiles(t, c.Templatesdir, map[string]string{"amp.html": `<html amp><h1>{{.Post.Title}}</h1>{{.Post.BodySafe}}</html>`})
+	})
+	w := httptest.NewRecorder()
+	viewPostHandler(w, httptest.NewRequest("GET", "/posts/hello-world", nil), blog, "post.html")
+	page := w.Body.String()
+	w = httptest.NewRecorder()
+	viewPostHandler(w, httptest.NewRequest("GET", "/posts/hello-world/amp", nil), blog, "post.html")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<html amp><h1>Hello World</h1><p>The body</p>") {
+		t.Errorf("expected the AMP page, got %d %q", w.Code, w.Body.String())
+	}
+	if w.Body.String() == page {
+		t.Errorf("expected the AMP markup to differ from the post page")
+	}
+
+	// The AMP page is not found when the theme has no AMP template
+	blog = newTestBlog(t, posts, nil)
+	w = httptest.NewRecorder()
+	viewPostHandler(w, httptest.NewRequest("GET", "/posts/hello-world/amp", nil), blog, "post.html")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d without an AMP template, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestDefaultImage(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"plain.json": `{"Title": "Plain", "Body": "<p>No image</p>"}`,
+		"cover.json": `{"Title": "Cover", "Body": "<p>Image</p>", "CoverImage": "/assets/cover.png"}`,
+	}, func(c *Configuration) {
+		c.SiteURL, c.DefaultImage = "https://example.com/", "/assets/default.png"
+	})
+	setTemplate(t, blog, "home.html", `{{.Image}}`)
+	setTemplate(t, blog, "post.html", `{{.Image}}`)
+	tests := []struct {
+		handler  func(http.ResponseWriter, *http.Request, *Blog, string)
+		template string
+		path     string
+		image    string
+	}{
+		{viewHomeHandler, "home.html", "/", "https://example.com/assets/default.png"},
+		{viewPostHandler, "post.html", "/posts/plain", "https://example.com/assets/default.png"},
+		{viewPostHandler, "post.html", "/posts/cover", "https://example.com/assets/cover.png"},
+	}
+	for _, test := range tests {
+		if image := get(blog, test.handler, test.template, test.path).Body.String(); image != test.image {
+			t.Errorf("%s: expected the image %s, got %s", test.path, test.image, image)
+		}
+	}
+}
+
+func TestDisplayTimezone(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Created": "2013-06-01T23:30:00Z"}`,
+	}, func(c *Configuration) {
+		c.DisplayTimezone = "Asia/Tokyo"
+	})
+	created := time.Date(2013, 6, 1, 23, 30, 0, 0, time.UTC)
+	if formatted := blog.formatDate(time.RFC3339, created); formatted != "2013-06-02T08:30:00+09:00" {
+		t.Errorf("expected the date within the display timezone, got %s", formatted)
+	}
+	if local := blog.localTime(created); !local.Equal(created) || local.Location().String() != "Asia/Tokyo" {
+		t.Errorf("expected the same time within the display timezone, got %s", local)
+	}
+
+	// The helpers are available within the templates
+	setTemplate(t, blog, "post.html", `{{date "2006-01-02 15:04 MST" .Post.Created}}`)
+	if page := get(blog, viewPostHandler, "post.html", "/posts/hello-world").Body.String(); page != "2013-06-02 08:30 JST" {
+		t.Errorf("expected the template to format the date within the display timezone, got %q", page)
+	}
+}
+
+func TestPostsPath(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	}, func(c *Configuration) {
+		c.PostsPath = "/articles/"
+	})
+	post := blog.snapshot().postMap["hello-world"]
+	if post.URL() != "/articles/hello-world" {
+		t.Errorf("expected the post URL to use the posts path, got %s", post.URL())
+	}
+	if w := get(blog, viewPostsHandler, "posts.html", "/articles"); !strings.Contains(w.Body.String(), "<h2>Hello World</h2>") {
+		t.Errorf("expected the listing to be served, got %d %q", w.Code, w.Body.String())
+	}
+	if w := get(blog, viewPostHandler, "post.html", "/articles/hello-world"); !strings.Contains(w.Body.String(), "<p>The body</p>") {
+		t.Errorf("expected the post to be served, got %d %q", w.Code, w.Body.String())
+	}
+
+	// The default path is no longer used
+	if w := get(blog, viewPostHandler, "post.html", "/posts/hello-world"); w.Code == http.StatusOK {
+		t.Errorf("expected the default posts path not to serve the post")
+	}
+}
+
+func TestPageDescription(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Summary": "The summary", "Body": "<p>The body</p>"}`,
+	}, func(c *Configuration) {
+		c.Description = "The blog description"
+	})
+	setTemplate(t, blog, "home.html", `{{.Description}}`)
+	setTemplate(t, blog, "post.html", `{{.Description}}`)
+	if description := get(blog, viewHomeHandler, "home.html", "/").Body.String(); description != "The blog description" {
+		t.Errorf("expected the home page to use the blog description, got %q", description)
+	}
+	if description := get(blog, viewPostHandler, "post.html", "/posts/hello-world").Body.String(); description != "The summary" {
+		t.Errorf("expected the post page to use the summary, got %q", description)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.RequestTimeout = 10 * time.Millisecond
+	})
+	release := make(chan struct{})
+	defer close(release)
+	handler := blog.timeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "<title>"+blog.message("unavailable.title")+"</title>") {
+		t.Errorf("expected the themed page, got %q", w.Body.String())
+	}
+}
+
+func TestNakedSlugRedirect(t *testing.T) {
+	posts := map[string]string{"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`}
+	blog := newTestBlog(t, posts, func(c *Configuration) {
+		c.RedirectNakedSlugs = true
+	})
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/hello-world", http.StatusMovedPermanently, "/posts/hello-world"},
+		{"/unknown", http.StatusFound, "/notfound"},
+	}
+	for _, test := range tests {
+		w := get(blog, viewHomeHandler, "home.html", test.path)
+		if w.Code != test.status || w.Header().Get("Location") != test.location {
+			t.Errorf("%s: expected %d to %s, got %d to %s", test.path, test.status, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+
+	// The slugs are not redirected unless enabled
+	blog = newTestBlog(t, posts, nil)
+	if w := get(blog, viewHomeHandler, "home.html", "/hello-world"); w.Header().Get("Location") != "/notfound" {
+		t.Errorf("expected the slug not to be redirected to the post, got %d to %s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestFooter(t *testing.T) {
+	version, commit := Version, Commit
+	defer func() { Version, Commit = version, commit }()
+	Version, Commit = "1.2.3", "abc123"
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.CopyrightOwner = "Landon Wainwright"
+	})
+	setTemplate(t, blog, "footer.html", `{{define "footer"}}{{with .Footer}}&copy; {{.CopyrightYear}} {{.CopyrightOwner}} {{.Version}} ({{.Commit}}){{end}}{{end}}`)
+	setTemplate(t, blog, "home.html", `{{template "footer" .}}`)
+	expected := fmt.Sprintf("&copy; %d Landon Wainwright 1.2.3 (abc123)", time.Now().Year())
+	if footer := get(blog, viewHomeHandler, "home.html", "/").Body.String(); footer != expected {
+		t.Errorf("expected the footer %q, got %q", expected, footer)
+	}
+}
+
+func TestHasMorePosts(t *testing.T) {
+	for _, test := range []struct {
+		posts int
+		more  string
+	}{{3, "true"}, {2, "false"}, {1, "false"}} {
+		blog := newTestBlog(t, numberedPosts(test.posts), func(c *Configuration) {
+			c.NoOfRecentPosts = 2
+		})
+		setTemplate(t, blog, "home.html", `{{.HasMorePosts}}{{range .Posts}} {{.Title}}{{end}}`)
+		page := get(blog, viewHomeHandler, "home.html", "/").Body.String()
+		if !strings.HasPrefix(page, test.more) {
+			t.Errorf("%d posts: expected HasMorePosts to be %s, got %q", test.posts, test.more, page)
+		}
+		if test.posts == 3 && page != "true Post 3 Post 2" {
+			t.Errorf("expected only the recent posts to be listed, got %q", page)
+		}
+	}
+}
+
+func TestPageLinks(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(5), func(c *Configuration) {
+		c.PostsPerPage = 2
+	})
+	w := get(blog, viewPostsHandler, "posts.html", "/posts?page=2")
+	expected := `</posts?page=1>; rel="first", </posts?page=1>; rel="prev", </posts?page=3>; rel="next", </posts?page=3>; rel="last"`
+	if link := w.Header().Get("Link"); link != expected {
+		t.Errorf("expected the links %s, got %s", expected, link)
+	}
+	if !strings.Contains(w.Body.String(), "<h2>Post 3</h2><h2>Post 2</h2>") {
+		t.Errorf("expected the second page of posts, got %q", w.Body.String())
+	}
+}
+
+func TestHomeRedirectToLatest(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(2), func(c *Configuration) {
+		c.HomeRedirectToLatest = true
+	})
+	if w := get(blog, viewHomeHandler, "home.html", "/"); w.Code != http.StatusFound || w.Header().Get("Location") != "/posts/post-2" {
+		t.Errorf("expected a redirect to the newest post, got %d to %s", w.Code, w.Header().Get("Location"))
+	}
+
+	// The home page is rendered when there are no posts to redirect to
+	blog = newTestBlog(t, nil, func(c *Configuration) {
+		c.HomeRedirectToLatest = true
+	})
+	if w := get(blog, viewHomeHandler, "home.html", "/"); w.Code != http.StatusOK || w.Body.String() != "<title>Test</title>" {
+		t.Errorf("expected the home page, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestReadMoreText(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(1), func(c *Configuration) {
+		c.ReadMoreText = "Continue reading"
+	})
+	setTemplate(t, blog, "home.html", `{{.ReadMoreText}}`)
+	if text := get(blog, viewHomeHandler, "home.html", "/").Body.String(); text != "Continue reading" {
+		t.Errorf("expected the configured read more text, got %q", text)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.Messages = map[string]string{"notfound.title": "Introuvable"}
+	})
+	if page := get(blog, notFoundHandler, "notfound.html", "/notfound").Body.String(); !strings.HasPrefix(page, "<title>Introuvable</title>") {
+		t.Errorf("expected the overridden title, got %q", page)
+	}
+
+	// The messages are also available within the templates, falling back to the defaults
+	setTemplate(t, blog, "home.html", `{{t "notfound.title"}} {{t "ratelimited.title"}}`)
+	expected := "Introuvable " + defaultMessages["ratelimited.title"]
+	if page := get(blog, viewHomeHandler, "home.html", "/").Body.String(); page != expected {
+		t.Errorf("expected %q, got %q", expected, page)
+	}
+}
+
+func TestTrailingSlashRedirect(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(1), nil)
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/posts/post-1/", http.StatusMovedPermanently, "/posts/post-1"},
+		{"/posts/post-1//", http.StatusMovedPermanently, "/posts/post-1"},
+		{"/posts/unknown/", http.StatusFound, "/notfound"},
+	}
+	for _, test := range tests {
+		w := get(blog, viewPostHandler, "post.html", test.path)
+		if w.Code != test.status || w.Header().Get("Location") != test.location {
+			t.Errorf("%s: expected %d to %s, got %d to %s", test.path, test.status, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestOpenGraphDefaults(t *testing.T) {
+	tests := []struct {
+		configure func(*Configuration)
+		expected  string
+	}{
+		{nil, "Test en_US"},
+		{func(c *Configuration) { c.SiteName, c.Locale = "My Site", "en_GB" }, "My Site en_GB"},
+	}
+	for _, test := range tests {
+		blog := newTestBlog(t, nil, test.configure)
+		setTemplate(t, blog, "home.html", `{{.SiteName}} {{.Locale}}`)
+		if page := get(blog, viewHomeHandler, "home.html", "/").Body.String(); page != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, page)
+		}
+	}
+}
+
+func TestDateSlugPermalinks(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(1), func(c *Configuration) {
+		c.PermalinkStyle = PermalinkDateSlug
+	})
+	post := blog.snapshot().postMap["post-1"]
+	if post.URL() != "/posts/2013/06/post-1" {
+		t.Errorf("expected the date based link, got %s", post.URL())
+	}
+	if w := get(blog, viewPostHandler, "post.html", post.URL()); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<h1>Post 1</h1>") {
+		t.Errorf("expected the post at its link, got %d %q", w.Code, w.Body.String())
+	}
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{"/posts/2014/01/post-1", http.StatusMovedPermanently, "/posts/2013/06/post-1"},
+		{"/posts/2013/06/unknown", http.StatusFound, "/notfound"},
+		{"/posts/post-1", http.StatusFound, "/notfound"},
+	}
+	for _, test := range tests {
+		w := get(blog, viewPostHandler, "post.html", test.path)
+		if w.Code != test.status || w.Header().Get("Location") != test.location {
+			t.Errorf("%s: expected %d to %s, got %d to %s", test.path, test.status, test.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestConcurrencyHandler(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.MaxConcurrentRequests = 1
+	})
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := blog.concurrencyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+	}))
+
+	// Hold the only slot while the next request is made
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	}()
+	<-started
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected a 503 with Retry-After, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// The slot is available again once the request has finished
+	close(release)
+	<-done
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestDraftsInDevelopmentMode(t *testing.T) {
+	posts := numberedPosts(1)
+	posts["draft.json"] = `{"Title": "Draft", "Draft": true, "Created": "2013-07-01T00:00:00Z"}`
+	tests := []struct {
+		development bool
+		expected    string
+	}{
+		{true, " Draft (draft) Post 1"},
+		{false, " Post 1"},
+	}
+	for _, test := range tests {
+		blog := newTestBlog(t, posts, func(c *Configuration) {
+			c.DevelopmentMode = test.development
+		})
+		setTemplate(t, blog, "posts.html", `{{range .Posts}} {{.Title}}{{if .Draft}} (draft){{end}}{{end}}`)
+		if page := get(blog, viewPostsHandler, "posts.html", "/posts").Body.String(); page != test.expected {
+			t.Errorf("development mode %t: expected %q, got %q", test.development, test.expected, page)
+		}
+	}
+}
+
+func TestNotFoundSuggestions(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(3), func(c *Configuration) {
+		c.NoOfRecentPosts = 2
+	})
+	setTemplate(t, blog, "notfound.html", `{{.Message}}{{range .Posts}} {{.Title}}{{end}}`)
+	w := get(blog, notFoundHandler, "notfound.html", "/notfound")
+	expected := blog.message("notfound.message") + " Post 3 Post 2"
+	if w.Code != http.StatusNotFound || w.Body.String() != expected {
+		t.Errorf("expected %d %q, got %d %q", http.StatusNotFound, expected, w.Code, w.Body.String())
+	}
+}
+
+func TestRenderPostToString(t *testing.T) {
+	configuration := &Configuration{Title: "Test", Postsdir: t.TempDir(), Templatesdir: t.TempDir(), Assetsdir: t.TempDir()}
+	writeFiles(t, configuration.Postsdir, numberedPosts(1))
+	writeFiles(t, configuration.Templatesdir, testTemplates)
+
+	// The posts and templates are loaded by the first render
+	blog := New(configuration)
+	html, err := blog.RenderPostToString("post-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "<title>Post 1</title><h1>Post 1</h1><p>Body 1</p>"; html != expected {
+		t.Errorf("expected %q, got %q", expected, html)
+	}
+	if _, err := blog.RenderPostToString("unknown"); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected %v, got %v", ErrPostNotFound, err)
+	}
+}
+
+func TestHSTSHandler(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.HSTSMaxAge, c.HSTSIncludeSubdomains, c.HSTSPreload = 31536000, true, true
+	})
+	handler := blog.hstsHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name     string
+		tls      bool
+		expected string
+	}{
+		{"https", true, "max-age=31536000; includeSubDomains; preload"},
+		{"http", false, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if header := w.Header().Get("Strict-Transport-Security"); header != test.expected {
+			t.Errorf("%s: expected the header %q, got %q", test.name, test.expected, header)
+		}
+	}
+}
+
+func TestGlobalData(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(1), func(c *Configuration) {
+		c.GlobalData = map[string]interface{}{"twitter": "@landonia"}
+	})
+	setTemplate(t, blog, "home.html", `{{.Site.twitter}}`)
+	setTemplate(t, blog, "post.html", `{{.Site.twitter}}`)
+	for _, w := range []*httptest.ResponseRecorder{
+		get(blog, viewHomeHandler, "home.html", "/"),
+		get(blog, viewPostHandler, "post.html", "/posts/post-1"),
+	} {
+		if w.Body.String() != "@landonia" {
+			t.Errorf("expected the global data, got %q", w.Body.String())
+		}
+	}
+}
+
+func TestMinifyHTML(t *testing.T) {
+	posts := map[string]string{"hello.json": `{"Title": "Hello World", "Body": "<p>\n    The   body\n</p>\n\n<p>More</p>"}`}
+	plain := get(newTestBlog(t, posts, nil), viewPostHandler, "post.html", "/posts/hello-world").Body.String()
+	blog := newTestBlog(t, posts, func(c *Configuration) {
+		c.MinifyHTML = true
+	})
+	w := get(blog, viewPostHandler, "post.html", "/posts/hello-world")
+	if w.Code != http.StatusOK || len(w.Body.String()) >= len(plain) {
+		t.Errorf("expected the page to be smaller than %q, got %d %q", plain, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "<h1>Hello World</h1>") || !strings.Contains(w.Body.String(), "The body") {
+		t.Errorf("expected the post to be rendered, got %q", w.Body.String())
+	}
+
+	// The HTML is left readable in development mode
+	blog = newTestBlog(t, posts, func(c *Configuration) {
+		c.MinifyHTML, c.DevelopmentMode = true, true
+	})
+	if page := get(blog, viewPostHandler, "post.html", "/posts/hello-world").Body.String(); page != plain {
+		t.Errorf("expected the page not to be minified, got %q", page)
+	}
+}
+
+func TestLatestHandler(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(3), nil)
+	if w := get(blog, latestHandler, "notfound.html", "/latest"); w.Code != http.StatusFound || w.Header().Get("Location") != "/posts/post-3" {
+		t.Errorf("expected a redirect to the newest post, got %d to %s", w.Code, w.Header().Get("Location"))
+	}
+
+	// There is nothing to redirect to without any posts
+	blog = newTestBlog(t, nil, nil)
+	if w := get(blog, latestHandler, "notfound.html", "/latest"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHomeExcerptLength(t *testing.T) {
+	posts := map[string]string{
+		"long.json":  `{"Title": "Long", "Body": "<p>The quick <b>brown</b> fox jumps over the lazy dog</p>", "Created": "2013-06-02T00:00:00Z"}`,
+		"short.json": `{"Title": "Short", "Body": "<p>A <b>short</b> body</p>", "Created": "2013-06-01T00:00:00Z"}`,
+	}
+	blog := newTestBlog(t, posts, func(c *Configuration) {
+		c.HomeExcerptLength = 20
+	})
+	setTemplate(t, blog, "home.html", `{{range .Posts}}[{{$.Excerpt .}}]{{end}}`)
+	expected := "[The quick brown fox&hellip;][<p>A <b>short</b> body</p>]"
+	if page := get(blog, viewHomeHandler, "home.html", "/").Body.String(); page != expected {
+		t.Errorf("expected %q, got %q", expected, page)
+	}
+
+	// The listing is not truncated without a length
+	blog = newTestBlog(t, posts, nil)
+	setTemplate(t, blog, "home.html", `{{range .Posts}}[{{$.Excerpt .}}]{{end}}`)
+	expected = "[<p>The quick <b>brown</b> fox jumps over the lazy dog</p>][<p>A <b>short</b> body</p>]"
+	if page := get(blog, viewHomeHandler, "home.html", "/").Body.String(); page != expected {
+		t.Errorf("expected %q, got %q", expected, page)
+	}
+}
+
+func TestRootFileNotFound(t *testing.T) {
+	blog := newTestBlog(t, nil, nil)
+	for _, path := range []string{"/sitemap.xml", "/favicon.ico"} {
+		w := get(blog, viewHomeHandler, "home.html", path)
+		if w.Code != http.StatusNotFound || w.Header().Get("Location") != "" {
+			t.Errorf("%s: expected status %d without a redirect, got %d to %s", path, http.StatusNotFound, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	blog := newTestBlog(t, nil, nil)
+	// Will make a second request to a handler that only allows one
+	limited := func(path string) *httptest.ResponseRecorder {
+		handler := blog.limitHandler(tollbooth.NewLimiter(1, time.Minute), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected the first request to be allowed, got %d", path, w.Code)
+		}
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+	message := blog.message("ratelimited.message")
+
+	// Without a theme template the plain message is used
+	w := limited("/posts")
+	if w.Code != http.StatusTooManyRequests || strings.TrimSpace(w.Body.String()) != message {
+		t.Errorf("expected %d %q, got %d %q", http.StatusTooManyRequests, message, w.Code, w.Body.String())
+	}
+
+	// The API always responds with JSON
+	w = limited("/api/stats")
+	if expected := `{"error":"` + message + `"}`; w.Code != http.StatusTooManyRequests || strings.TrimSpace(w.Body.String()) != expected {
+		t.Errorf("expected %d %s, got %d %s", http.StatusTooManyRequests, expected, w.Code, w.Body.String())
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json; charset=utf-8" {
+		t.Errorf("expected a JSON response, got %s", contentType)
+	}
+
+	// The theme template is used when there is one
+	setTemplate(t, blog, "ratelimited.html", `{{template "header" .}}{{.Message}}`)
+	w = limited("/posts")
+	expected := "<title>" + blog.message("ratelimited.title") + `</title><meta name="robots" content="noindex">` + message
+	if w.Code != http.StatusTooManyRequests || w.Body.String() != expected {
+		t.Errorf("expected %d %q, got %d %q", http.StatusTooManyRequests, expected, w.Code, w.Body.String())
+	}
+}
+
+func TestNoIndex(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hidden.json":  `{"Title": "Hidden", "Body": "<p>Body</p>", "NoIndex": true}`,
+		"visible.json": `{"Title": "Visible", "Body": "<p>Body</p>"}`,
+	}, nil)
+	meta := `<meta name="robots" content="noindex">`
+	if page := get(blog, viewPostHandler, "post.html", "/posts/hidden").Body.String(); !strings.Contains(page, meta) {
+		t.Errorf("expected the noindex meta tag, got %q", page)
+	}
+	if page := get(blog, viewPostHandler, "post.html", "/posts/visible").Body.String(); strings.Contains(page, meta) {
+		t.Errorf("expected no noindex meta tag, got %q", page)
+	}
+}
+
+// The routes are registered on the default ServeMux, so this is the only test that can set up the blog successfully
+func TestRoutes(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(1), func(c *Configuration) {
+		c.Pages = map[string]string{"/contact": "contact.html"}
+	})
+	if routes := blog.Routes(); len(routes) != 0 {
+		t.Errorf("expected no routes before the blog is set up, got %v", routes)
+	}
+	handler, err := blog.setup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/", "/about", "/admin/reload", "/api/", "/api/posts", "/api/posts/", "/api/posts/popular", "/api/stats",
+		"/assets/", "/assets/manifest.json", "/contact", "/humans.txt", "/latest", "/notfound", "/posts", "/posts/", "/preview/", "/subscribe"}
+	if routes := blog.Routes(); strings.Join(routes, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected the routes %v, got %v", expected, routes)
+	}
+
+	// The routes are served by the returned handler
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/posts/post-1", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "<h1>Post 1</h1>") {
+		t.Errorf("expected the post to be served, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestArchived(t *testing.T) {
+	recent := time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
+	posts := map[string]string{
+		"old.json":    `{"Title": "Old", "Body": "<p>Body</p>", "Created": "2013-06-01T00:00:00Z"}`,
+		"recent.json": `{"Title": "Recent", "Body": "<p>Body</p>", "Created": "` + recent + `"}`,
+	}
+	tests := []struct {
+		archiveAfter time.Duration
+		expected     string
+	}{
+		{365 * 24 * time.Hour, " Recent false Old true"},
+		{0, " Recent false Old false"},
+	}
+	for _, test := range tests {
+		blog := newTestBlog(t, posts, func(c *Configuration) {
+			c.ArchiveAfter = test.archiveAfter
+		})
+		setTemplate(t, blog, "posts.html", `{{range .Posts}} {{.Title}} {{$.Archived .}}{{end}}`)
+		if page := get(blog, viewPostsHandler, "posts.html", "/posts").Body.String(); page != test.expected {
+			t.Errorf("archive after %s: expected %q, got %q", test.archiveAfter, test.expected, page)
+		}
+		for slug, archived := range map[string]bool{"old": test.archiveAfter > 0, "recent": false} {
+			if post := blog.snapshot().postMap[slug]; post.IsArchived(test.archiveAfter) != archived {
+				t.Errorf("archive after %s: expected %s to be archived %t", test.archiveAfter, slug, archived)
+			}
+		}
+	}
+}
+
+func TestPostRouteWithoutPost(t *testing.T) {
+	for _, style := range []string{PermalinkSlug, PermalinkDateSlug} {
+		blog := newTestBlog(t, numberedPosts(1), func(c *Configuration) {
+			c.PermalinkStyle = style
+		})
+		for _, path := range []string{"/posts/", "/posts//", "/posts///", "/posts"} {
+			w := get(blog, viewPostHandler, "post.html", path)
+			if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/posts" {
+				t.Errorf("%s %s: expected a redirect to the listing, got %d to %s", style, path, w.Code, w.Header().Get("Location"))
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// The ASCII spelling of the letters that do not decompose into an ASCII base letter
+var transliterations = map[rune]string{
+
+	// Latin
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i",
+
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "yu", 'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th", 'ι': "i", 'κ': "k",
+	'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t",
+	'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+
+	// Japanese kana (the katakana are converted to hiragana first)
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o", 'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go", 'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo", 'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do", 'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho", 'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po", 'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo", 'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro", 'わ': "wa", 'を': "o",
+	'ん': "n", 'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o", 'ゔ': "vu",
+}
+
+// The small kana that combine with the preceding syllable, e.g. きょ becomes kyo
+var combiningKana = map[rune]string{'ゃ': "a", 'ゅ': "u", 'ょ': "o"}
+
+// Will return the separator that replaces the spaces of the titles within the slugs
+func (blog *Blog) slugSeparator() string {
+	if blog.configuration.NoSlugSeparator {
+		return ""
+	}
+	if blog.configuration.SlugSeparator == "" {
+		return "-"
+	}
+	return blog.configuration.SlugSeparator
+}
+
+// Will generate the slug that is used to locate the post with the given title
+func (blog *Blog) slugify(title string) string {
+	separator := blog.slugSeparator()
+	slug := strings.ToLower(strings.Replace(title, " ", separator, -1))
+	if !blog.configuration.TransliterateSlugs {
+		return slug
+	}
+
+	// Characters without a transliteration (e.g. Chinese characters) are dropped, and the
+	// separators left behind are collapsed so that the slug stays clean
+	ascii := transliterate(strings.ToLower(title), separator)
+	if ascii == "" {
+		logger.Warn("Cannot transliterate the title '%s' into a slug, using '%s'", title, slug)
+		return slug
+	}
+	return ascii
+}
+
+// Will fold the text into ASCII by removing any diacritics and transliterating the other
+// letters, the spaces are replaced by the separator without repeating it at either end
+func transliterate(s, separator string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+
+	var words []string
+	var b bytes.Buffer
+	double := false
+	for _, r := range folded {
+
+		// The katakana share the spelling of the hiragana
+		if r >= 'ァ' && r <= 'ヶ' {
+			r -= 'ァ' - 'ぁ'
+		}
+		switch {
+		case unicode.IsSpace(r):
+			if b.Len() > 0 {
+				words = append(words, b.String())
+				b.Reset()
+			}
+		case r < unicode.MaxASCII:
+			b.WriteRune(r)
+		case r == 'っ':
+
+			// The small tsu doubles the following consonant
+			double = true
+		case combiningKana[r] != "":
+			w := strings.TrimSuffix(b.String(), "i")
+			b.Reset()
+			b.WriteString(w)
+			if !strings.HasSuffix(w, "sh") && !strings.HasSuffix(w, "ch") && !strings.HasSuffix(w, "j") {
+				b.WriteString("y")
+			}
+			b.WriteString(combiningKana[r])
+		default:
+			f := transliterations[unicode.ToLower(r)]
+			if double && f != "" {
+				b.WriteByte(f[0])
+			}
+			double = false
+			b.WriteString(f)
+		}
+	}
+	if b.Len() > 0 {
+		words = append(words, b.String())
+	}
+	return strings.Join(words, separator)
+}
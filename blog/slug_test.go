@@ -0,0 +1,67 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title         string
+		transliterate bool
+		slug          string
+	}{
+		{"Café Göteborg", false, "café-göteborg"},
+		{"Café Göteborg", true, "cafe-goteborg"},
+		{"Straße  und Ærø", true, "strasse-und-aero"},
+		{"Привет мир", true, "privet-mir"},
+		{"Καλημέρα κόσμε", true, "kalimera-kosme"},
+		{"東京 タワー", true, "tawa"},
+		{"きょうと", true, "kyouto"},
+		{"しゃしん", true, "shashin"},
+		{"Go 言語", true, "go"},
+		{"東京", true, "東京"},
+	}
+	for _, test := range tests {
+		blog := &Blog{configuration: &Configuration{SlugSeparator: "-", TransliterateSlugs: test.transliterate}}
+		if slug := blog.slugify(test.title); slug != test.slug {
+			t.Errorf("expected the slug of '%s' to be '%s', got '%s'", test.title, test.slug, slug)
+		}
+	}
+}
+
+func TestSlugSeparator(t *testing.T) {
+	tests := []struct {
+		configure func(*Configuration)
+		slug      string
+	}{
+		{func(c *Configuration) {}, "hello-big-world"},
+		{func(c *Configuration) { c.SlugSeparator = "_" }, "hello_big_world"},
+		{func(c *Configuration) { c.NoSlugSeparator = true }, "hellobigworld"},
+	}
+	for _, test := range tests {
+		blog := newTestBlog(t, map[string]string{
+			"hello.json": `{"Title": "Hello Big World", "Body": "<p>The body</p>"}`,
+		}, test.configure)
+		post := blog.snapshot().postMap[test.slug]
+		if post == nil {
+			t.Errorf("expected the post to be located using '%s'", test.slug)
+			continue
+		}
+		if post.SafeTitle() != test.slug || post.URL() != "/posts/"+test.slug {
+			t.Errorf("expected the links to use '%s', got '%s' and '%s'", test.slug, post.SafeTitle(), post.URL())
+		}
+
+		// The post is served from its link
+		w := httptest.NewRecorder()
+		viewPostHandler(w, httptest.NewRequest("GET", post.URL(), nil), blog, "post.html")
+		if !strings.Contains(w.Body.String(), "<p>The body</p>") {
+			t.Errorf("expected the post to be served from %s, got %q", post.URL(), w.Body.String())
+		}
+	}
+}
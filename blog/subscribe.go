@@ -0,0 +1,92 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"sync"
+)
+
+// ErrDuplicateSubscriber is returned by a SubscriberStore when the email address has already subscribed
+var ErrDuplicateSubscriber = errors.New("blog: already subscribed")
+
+// SubscriberStore receives the email addresses submitted to the subscribe endpoint
+type SubscriberStore interface {
+
+	// Add the email address, returning ErrDuplicateSubscriber if it has already been added
+	Add(email string) error
+}
+
+// MemorySubscriberStore keeps the subscribers in memory, it is the default store
+type MemorySubscriberStore struct {
+	sync.Mutex
+	emails map[string]bool
+}
+
+// Add the email address to the store
+func (store *MemorySubscriberStore) Add(email string) error {
+	store.Lock()
+	defer store.Unlock()
+	if store.emails == nil {
+		store.emails = make(map[string]bool)
+	}
+	key := strings.ToLower(email)
+	if store.emails[key] {
+		return ErrDuplicateSubscriber
+	}
+	store.emails[key] = true
+	return nil
+}
+
+// Emails returns all of the subscribed email addresses
+func (store *MemorySubscriberStore) Emails() []string {
+	store.Lock()
+	defer store.Unlock()
+	emails := make([]string, 0, len(store.emails))
+	for email := range store.emails {
+		emails = append(emails, email)
+	}
+	return emails
+}
+
+// Handles the requests to subscribe an email address
+func subscribeHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+
+	// Only allow the form to be submitted using a POST
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Only accept a plain email address (without a display name)
+	email := strings.TrimSpace(r.FormValue("email"))
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		blog.renderSubscribe(w, template, http.StatusBadRequest, "subscribe.invalid")
+		return
+	}
+	if err := blog.configuration.Subscribers.Add(email); err != nil {
+		if errors.Is(err, ErrDuplicateSubscriber) {
+			blog.renderSubscribe(w, template, http.StatusConflict, "subscribe.duplicate")
+			return
+		}
+		logger.Error("Cannot add subscriber: %s", err.Error())
+		blog.renderSubscribe(w, template, http.StatusInternalServerError, "subscribe.error")
+		return
+	}
+	blog.renderSubscribe(w, template, http.StatusOK, "subscribe.success")
+}
+
+// Will render the outcome of the subscription using the subscribe template (if the theme has one)
+func (blog *Blog) renderSubscribe(w http.ResponseWriter, template string, status int, message string) {
+	if blog.templates.Lookup(template) == nil {
+		http.Error(w, blog.message(message), status)
+		return
+	}
+	blog.renderTemplate(w, template, status, PageContent{Title: blog.message("subscribe.title"), Message: blog.message(message)})
+}
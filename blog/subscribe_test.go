@@ -0,0 +1,50 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSubscribeHandler(t *testing.T) {
+	blog := newTestBlog(t, nil, nil)
+	tests := []struct {
+		name    string
+		email   string
+		status  int
+		message string
+	}{
+		{"valid", "reader@example.com", http.StatusOK, "subscribe.success"},
+		{"invalid", "not an email", http.StatusBadRequest, "subscribe.invalid"},
+		{"display name", "Reader <other@example.com>", http.StatusBadRequest, "subscribe.invalid"},
+		{"duplicate", "Reader@Example.com", http.StatusConflict, "subscribe.duplicate"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/subscribe", strings.NewReader(url.Values{"email": {test.email}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		subscribeHandler(w, r, blog, "subscribe.html")
+		if w.Code != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), blog.message(test.message)) {
+			t.Errorf("%s: expected the message %q, got %q", test.name, blog.message(test.message), w.Body.String())
+		}
+	}
+	if emails := blog.configuration.Subscribers.(*MemorySubscriberStore).Emails(); len(emails) != 1 || emails[0] != "reader@example.com" {
+		t.Errorf("expected only the valid email to be stored, got %v", emails)
+	}
+
+	// The form can only be submitted
+	w := httptest.NewRecorder()
+	subscribeHandler(w, httptest.NewRequest("GET", "/subscribe", nil), blog, "subscribe.html")
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST" {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
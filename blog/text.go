@@ -0,0 +1,42 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"html"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// The suffix of the path of the plain text variant of a post, e.g. /posts/my-post.txt
+const textSuffix = ".txt"
+
+// Matches the end of the block elements that separate the paragraphs of the plain text
+var blockEnd = regexp.MustCompile(`(?i)</(p|h[1-6]|li|blockquote|pre|div)>|<br\s*/?>`)
+
+// Will convert the HTML into plain text, keeping the paragraphs on separate lines
+func plainText(body string) string {
+	text := html.UnescapeString(stripTags(blockEnd.ReplaceAllString(body, "$0\n\n")))
+
+	// Tidy the whitespace left behind by the tags
+	var lines []string
+	blank := true
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" && blank {
+			continue
+		}
+		blank = line == ""
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
+
+// Will write the post as plain text with the HTML removed
+func textPostHandler(w http.ResponseWriter, post *Post) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(post.Title + "\n\n" + plainText(post.Body)))
+}
@@ -0,0 +1,32 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTextPost(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<h2>Intro</h2>\n<p>The <b>bold</b> &amp; the   brave</p><ul><li>One</li><li>Two</li></ul>"}`,
+	}, nil)
+	w := get(blog, viewPostHandler, "post.html", "/posts/hello-world.txt")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; charset=utf-8" {
+		t.Errorf("expected plain text, got %s", contentType)
+	}
+	expected := "Hello World\n\nIntro\n\nThe bold & the brave\n\nOne\n\nTwo\n"
+	if w.Body.String() != expected {
+		t.Errorf("expected %q, got %q", expected, w.Body.String())
+	}
+
+	// An unknown post is still not found
+	if w := get(blog, viewPostHandler, "post.html", "/posts/unknown.txt"); w.Header().Get("Location") != "/notfound" {
+		t.Errorf("expected the post not to be found, got %d", w.Code)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The name of the tracer that will be requested from the global tracer provider
+const tracerName = "github.com/landonia/simplegoblog/blog"
+
+// startSpan will start a new span if tracing has been enabled, otherwise the span
+// (if any) already within the context is returned so the caller can always end it
+func (blog *Blog) startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !blog.configuration.Tracing {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	// Use the global tracer provider so the user can choose how the spans are exported
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// traceHandler will wrap the handler within a span named after the route
+func (blog *Blog) traceHandler(route string, handler http.Handler) http.Handler {
+	if !blog.configuration.Tracing {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := blog.startSpan(r.Context(), route, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.route", route), attribute.String("http.method", r.Method),
+				attribute.String("http.client_ip", blog.clientIP(r))))
+		defer span.End()
+
+		// Capture the status so that it can be added to the span
+		sw := &statusResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		handler.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// setSpanPost will add the post slug to the span within the request context (if any)
+func setSpanPost(r *http.Request, slug string) {
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("blog.post.slug", slug))
+}
+
+// setSpanError will record the error against the span and mark the span as failed
+func setSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,91 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Will record the spans of the blog in memory
+func newTestExporter(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(t.Context()) })
+	return exporter
+}
+
+// Will return the value of the attribute of the span
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTraceHandler(t *testing.T) {
+	blog := newTestBlog(t, map[string]string{
+		"hello.json": `{"Title": "Hello World", "Body": "<p>The body</p>"}`,
+	}, func(c *Configuration) {
+		c.Tracing = true
+	})
+	exporter := newTestExporter(t)
+	handler := blog.traceHandler("/posts/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		viewPostHandler(w, r, blog, "post.html")
+	}))
+	for _, path := range []string{"/posts/hello-world", "/posts/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected a span for each request, got %d", len(spans))
+	}
+	for i, expected := range []struct {
+		slug   string
+		status int64
+	}{{"hello-world", http.StatusOK}, {"missing", http.StatusFound}} {
+		span := spans[i]
+		if span.Name != "/posts/" || spanAttribute(span, "http.route").AsString() != "/posts/" {
+			t.Errorf("expected the span to be named after the route, got %s", span.Name)
+		}
+		if status := spanAttribute(span, "http.status_code").AsInt64(); status != expected.status {
+			t.Errorf("expected the status %d, got %d", expected.status, status)
+		}
+		if slug := spanAttribute(span, "blog.post.slug").AsString(); slug != expected.slug {
+			t.Errorf("expected the slug %s, got %s", expected.slug, slug)
+		}
+	}
+}
+
+func TestTraceLoadPostsError(t *testing.T) {
+	blog := newTestBlog(t, nil, func(c *Configuration) {
+		c.Tracing = true
+	})
+	exporter := newTestExporter(t)
+	blog.configuration.Postsdir = filepath.Join(t.TempDir(), "missing")
+	if err := blog.loadPosts(); err == nil {
+		t.Fatal("expected the load to fail")
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "loadPosts" {
+		t.Fatalf("expected the load to be traced, got %v", spans)
+	}
+	if spans[0].Status.Code != codes.Error {
+		t.Errorf("expected the span to be marked as failed, got %v", spans[0].Status)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// ViewCounter records the number of times each post has been viewed
+type ViewCounter interface {
+
+	// Increment the number of views of the post with the slug
+	Increment(slug string)
+
+	// Count returns the number of views of the post with the slug
+	Count(slug string) int
+}
+
+// MemoryViewCounter keeps the view counts in memory, it is the default counter
+type MemoryViewCounter struct {
+	sync.Mutex
+	counts map[string]int
+}
+
+// Increment the number of views of the post
+func (counter *MemoryViewCounter) Increment(slug string) {
+	counter.Lock()
+	defer counter.Unlock()
+	if counter.counts == nil {
+		counter.counts = make(map[string]int)
+	}
+	counter.counts[slug]++
+}
+
+// Count returns the number of views of the post
+func (counter *MemoryViewCounter) Count(slug string) int {
+	counter.Lock()
+	defer counter.Unlock()
+	return counter.counts[slug]
+}
+
+// PostViews is the number of views of a post returned by the popular posts API
+type PostViews struct {
+	Title string `json:"title"`
+	Slug  string `json:"slug"`
+	URL   string `json:"url"`
+	Views int    `json:"views"`
+}
+
+// Handles the requests for the most viewed posts, e.g. /api/posts/popular
+func apiPopularHandler(w http.ResponseWriter, r *http.Request, blog *Blog, template string) {
+	posts := blog.snapshot().posts
+	popular := make([]PostViews, 0, len(posts))
+	for _, post := range posts {
+		if views := blog.configuration.Views.Count(post.SafeTitle()); views > 0 {
+			popular = append(popular, PostViews{Title: post.Title, Slug: post.SafeTitle(),
+				URL: post.Permalink(blog.configuration.SiteURL), Views: views})
+		}
+	}
+
+	// The posts are already newest first so a stable sort keeps the newest first for the same count
+	sort.SliceStable(popular, func(i, j int) bool { return popular[i].Views > popular[j].Views })
+	writeJSON(w, http.StatusOK, popular)
+}
@@ -0,0 +1,47 @@
+// Copyright 2013 Landon Wainwright. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPopularPosts(t *testing.T) {
+	blog := newTestBlog(t, numberedPosts(3), nil)
+	setTemplate(t, blog, "post.html", `{{.Views}}`)
+
+	// View the first post once and the second post twice
+	for _, test := range []struct {
+		path  string
+		views string
+	}{{"/posts/post-1", "1"}, {"/posts/post-2", "1"}, {"/posts/post-2", "2"}} {
+		if views := get(blog, viewPostHandler, "post.html", test.path).Body.String(); views != test.views {
+			t.Errorf("%s: expected %s views, got %s", test.path, test.views, views)
+		}
+	}
+
+	// A HEAD request is not a view
+	w := httptest.NewRecorder()
+	viewPostHandler(w, httptest.NewRequest("HEAD", "/posts/post-1", nil), blog, "post.html")
+	if views := blog.configuration.Views.Count("post-1"); views != 1 {
+		t.Errorf("expected the HEAD request not to be counted, got %d", views)
+	}
+
+	// The most viewed are listed first and the posts without views are omitted
+	w = get(blog, apiPopularHandler, "", "/api/posts/popular")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	var popular []PostViews
+	if err := json.Unmarshal(w.Body.Bytes(), &popular); err != nil {
+		t.Fatal(err)
+	}
+	if len(popular) != 2 || popular[0].Slug != "post-2" || popular[0].Views != 2 || popular[1].Slug != "post-1" || popular[1].Views != 1 {
+		t.Errorf("expected the posts ordered by views, got %+v", popular)
+	}
+}